@@ -1,7 +1,10 @@
 package main
 
 import (
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 
@@ -12,8 +15,101 @@ import (
 type BulkInsert struct {
 	Data []types.CacheItem `json:"data"`
 }
+
+// One operation of the transaction. `item` is used by `set`, `key` by `get` and `delete`.
+type TxOperation struct {
+	Op   string          `json:"op"`
+	Key  string          `json:"key"`
+	Item types.CacheItem `json:"item"`
+}
+
+type TxRequest struct {
+	Operations []TxOperation `json:"operations"`
+}
+
+type TxResult struct {
+	Key   string           `json:"key"`
+	Found bool             `json:"found"`
+	Item  *types.CacheItem `json:"item,omitempty"`
+}
+
+type IncrRequest struct {
+	Delta *int64 `json:"delta"`
+}
+
+// Content type and file extension of export formats
+var exportFormats = map[string][2]string{
+	cache.ExportJSONLines: {"application/x-ndjson", "jsonl"},
+	cache.ExportCSV:       {"text/csv; charset=utf-8", "csv"},
+	cache.ExportProtobuf:  {"application/x-protobuf", "pb"},
+}
+
 type CacheHandler struct {
-	cache *cache.Cache
+	registry       *cache.Registry
+	allowedOrigins []string // WebSocket origins besides the API host
+}
+
+// Key of the namespace cache in gin context
+const namespaceContextKey = "cache"
+
+// Middleware which finds cache of `:namespace`, default one for routes without it.
+func (ch *CacheHandler) Namespace(c *gin.Context) {
+	name := c.Param("namespace")
+	if name == "" {
+		name = cache.DefaultNamespace
+	}
+	nsCache, found := ch.registry.Get(name)
+	if !found {
+		ch.Resp(c, http.StatusNotFound, gin.H{"message": "Namespace not found"})
+		c.Abort()
+		return
+	}
+	c.Set(namespaceContextKey, nsCache)
+}
+
+func (ch *CacheHandler) cacheOf(c *gin.Context) *cache.Cache {
+	return c.MustGet(namespaceContextKey).(*cache.Cache)
+}
+
+// Names of namespaces with their sizes
+func (ch *CacheHandler) Namespaces(c *gin.Context) {
+	namespaces := []gin.H{}
+	for _, name := range ch.registry.Names() {
+		if nsCache, found := ch.registry.Get(name); found {
+			namespaces = append(namespaces, gin.H{"name": name, "size": nsCache.Size()})
+		}
+	}
+	ch.Resp(c, http.StatusOK, gin.H{"data": namespaces, "count": len(namespaces)})
+}
+
+// Version of the item is used as its ETag
+func etag(version uint64) string {
+	return `"` + strconv.FormatUint(version, 10) + `"`
+}
+
+func parseETag(tag string) (uint64, error) {
+	tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+	return strconv.ParseUint(strings.Trim(tag, `"`), 10, 64)
+}
+
+// gin can't mix static routes like `/cache/tx` with `/cache/:key`, so these keys
+// are reserved for the endpoints and items can't have them
+var reservedKeys = map[string]bool{"tx": true, "export": true, "import": true, "stream": true, "ws": true}
+
+// Dispatches reserved keys to their endpoints of the method, others get `400`
+func (ch *CacheHandler) withReservedKeys(itemHandler gin.HandlerFunc, endpoints map[string]gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.Param("key")
+		if handler, found := endpoints[key]; found {
+			handler(c)
+			return
+		}
+		if reservedKeys[key] {
+			ch.Resp(c, http.StatusBadRequest, gin.H{"message": "Key is reserved", "key": key})
+			return
+		}
+		itemHandler(c)
+	}
 }
 
 func (ch *CacheHandler) Resp(c *gin.Context, status int, resp gin.H) {
@@ -21,13 +117,45 @@ func (ch *CacheHandler) Resp(c *gin.Context, status int, resp gin.H) {
 	c.JSON(status, resp)
 }
 
+// All items, or one page of them in key order with any of `?prefix=`, `?match=` (glob), `?limit=` and `?cursor=`.
 func (ch *CacheHandler) GetAllItems(c *gin.Context) {
-	items := ch.cache.GetAllItems()
-	ch.Resp(c, http.StatusOK, gin.H{"data": items, "count": len(*items)})
+	query := c.Request.URL.Query()
+	if query.Get("prefix") == "" && query.Get("match") == "" && query.Get("limit") == "" && query.Get("cursor") == "" {
+		items := ch.cacheOf(c).GetAllItems()
+		ch.Resp(c, http.StatusOK, gin.H{"data": items, "count": len(*items)})
+		return
+	}
+	ch.scanItems(c)
+}
+
+func (ch *CacheHandler) scanItems(c *gin.Context) {
+	pattern := c.Query("match")
+	if prefix := c.Query("prefix"); prefix != "" {
+		if pattern != "" {
+			ch.Resp(c, http.StatusBadRequest, gin.H{"message": "Use either `prefix` or `match`"})
+			return
+		}
+		pattern = cache.EscapeGlob(prefix) + "*"
+	}
+	limit := 0
+	if c.Query("limit") != "" {
+		var err error
+		if limit, err = strconv.Atoi(c.Query("limit")); err != nil || limit <= 0 {
+			ch.Resp(c, http.StatusBadRequest, gin.H{"message": "Invalid limit"})
+			return
+		}
+	}
+
+	items, cursor, err := ch.cacheOf(c).Scan(c.Query("cursor"), pattern, limit)
+	if err != nil {
+		ch.Resp(c, http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	ch.Resp(c, http.StatusOK, gin.H{"data": items, "count": len(items), "cursor": cursor})
 }
 
 func (ch *CacheHandler) DeleteAllItems(c *gin.Context) {
-	ch.cache.RemoveAllItems()
+	ch.cacheOf(c).RemoveAllItems()
 	ch.Resp(c, http.StatusOK, gin.H{})
 }
 
@@ -38,34 +166,236 @@ func (ch *CacheHandler) AddItems(c *gin.Context) {
 		return
 	}
 	for _, item := range bulkInsert.Data {
-		ch.cache.AddItem(item)
+		if !item.HasValidTTL() {
+			ch.Resp(c, http.StatusBadRequest, gin.H{"message": cache.ErrInvalidTTL.Error(), "key": item.Key})
+			return
+		}
+		if reservedKeys[item.Key] {
+			ch.Resp(c, http.StatusBadRequest, gin.H{"message": "Key is reserved", "key": item.Key})
+			return
+		}
+	}
+	// all or nothing so readers never see half of the batch
+	err := ch.cacheOf(c).Transaction(func(tx *cache.Tx) error {
+		for _, item := range bulkInsert.Data {
+			tx.Set(item)
+		}
+		return nil
+	})
+	if err != nil {
+		ch.Resp(c, http.StatusInsufficientStorage, gin.H{"message": err.Error()})
+		return
 	}
 	ch.Resp(c, http.StatusCreated, gin.H{"message": "Added successfuly", "count": len(bulkInsert.Data)})
 }
 
+// Applies all operations atomically. Results of `get` operations are returned in order.
+func (ch *CacheHandler) Transaction(c *gin.Context) {
+	var txRequest TxRequest
+	if err := c.ShouldBindJSON(&txRequest); err != nil {
+		ch.Resp(c, http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	results := []TxResult{}
+	err := ch.cacheOf(c).Transaction(func(tx *cache.Tx) error {
+		for i, operation := range txRequest.Operations {
+			switch operation.Op {
+			case "get":
+				item, found := tx.Get(operation.Key)
+				result := TxResult{Key: operation.Key, Found: found}
+				if found {
+					result.Item = &item
+				}
+				results = append(results, result)
+			case "set":
+				if !operation.Item.HasValidTTL() {
+					return fmt.Errorf("invalid TTL of `set` at position %d", i)
+				}
+				if reservedKeys[operation.Item.Key] {
+					return fmt.Errorf("reserved key of `set` at position %d", i)
+				}
+				tx.Set(operation.Item)
+			case "delete":
+				tx.Delete(operation.Key)
+			default:
+				return fmt.Errorf("unknown operation `%s` at position %d", operation.Op, i)
+			}
+		}
+		return nil
+	})
+	if err == cache.ErrNotStored {
+		ch.Resp(c, http.StatusInsufficientStorage, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		ch.Resp(c, http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	ch.Resp(c, http.StatusOK, gin.H{"data": results, "count": len(txRequest.Operations)})
+}
+
+// Streams all items in `?format=` (JSON Lines by default). With `?meta=1` also their TTL and metadata.
+func (ch *CacheHandler) Export(c *gin.Context) {
+	format := c.DefaultQuery("format", cache.ExportJSONLines)
+	formatInfo, known := exportFormats[format]
+	if !known {
+		ch.Resp(c, http.StatusBadRequest, gin.H{"message": "Unknown format, use jsonl, csv or protobuf"})
+		return
+	}
+
+	c.Header("Content-Type", formatInfo[0])
+	c.Header("Content-Disposition", `attachment; filename="cache.`+formatInfo[1]+`"`)
+	c.Status(http.StatusOK)
+	// status is already sent, so error can be just logged
+	if err := ch.cacheOf(c).Export(c.Writer, format, c.Query("meta") == "1"); err != nil {
+		fmt.Println("Export failed:", err)
+	}
+}
+
+// Reads items from the streamed body, `?format=jsonl|csv|kv` (JSON Lines by default).
+// Existing items are overwritten unless `?policy=skip`. Malformed lines are reported with their numbers.
+func (ch *CacheHandler) Import(c *gin.Context) {
+	format := c.DefaultQuery("format", cache.ImportJSONLines)
+	policy := c.DefaultQuery("policy", cache.ImportOverwrite)
+
+	result, err := ch.cacheOf(c).Import(c.Request.Body, format, policy)
+	if err != nil {
+		ch.Resp(c, http.StatusBadRequest, gin.H{"message": err.Error(), "data": result})
+		return
+	}
+	ch.Resp(c, http.StatusOK, gin.H{"data": result})
+}
+
 func (ch *CacheHandler) GetItem(c *gin.Context) {
-	item, ok := ch.cache.GetItem(c.Param("key"))
+	nsCache := ch.cacheOf(c)
+	item, meta, ok := nsCache.GetItemWithMeta(c.Param("key"))
 	if !ok {
+		// negative - origin confirmed there is no such item
+		ch.Resp(c, http.StatusNotFound, gin.H{"message": "Item not found", "negative": nsCache.IsNegative(c.Param("key"))})
+		return
+	}
+	resp := gin.H{"data": item}
+	c.Header("ETag", etag(meta.Version))
+	if meta.Stale {
+		resp["stale"] = true
+		c.Header("Warning", `110 - "Response is Stale"`)
+	}
+	if c.Query("meta") == "1" {
+		resp["meta"] = meta
+	}
+	ch.Resp(c, http.StatusOK, resp)
+}
+
+// Insert/update one item. Supports conditional writes:
+// - `If-Match: "<version>"` - update only if the item didn't change
+// - `If-Match: *` - update only existing item
+// - `If-None-Match: *` - insert only if there is no such item
+func (ch *CacheHandler) SetItem(c *gin.Context) {
+	var item types.CacheItem
+	if err := c.ShouldBindJSON(&item); err != nil {
+		ch.Resp(c, http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if !item.HasValidTTL() {
+		ch.Resp(c, http.StatusBadRequest, gin.H{"message": cache.ErrInvalidTTL.Error()})
+		return
+	}
+	item.Key = c.Param("key")
+
+	nsCache := ch.cacheOf(c)
+	var version uint64
+	var err error
+	ifMatch, ifNoneMatch := c.GetHeader("If-Match"), c.GetHeader("If-None-Match")
+	switch {
+	case ifMatch == "*":
+		version, err = nsCache.ReplaceIfPresent(item)
+	case ifMatch != "":
+		expectedVersion, parseErr := parseETag(ifMatch)
+		if parseErr != nil {
+			ch.Resp(c, http.StatusBadRequest, gin.H{"message": "Invalid If-Match header"})
+			return
+		}
+		version, err = nsCache.CompareAndSwap(item.Key, expectedVersion, item)
+	case ifNoneMatch == "*":
+		version, err = nsCache.AddIfAbsent(item)
+	case ifNoneMatch != "":
+		ch.Resp(c, http.StatusBadRequest, gin.H{"message": "Only `*` is supported in If-None-Match header"})
+		return
+	default:
+		version, err = nsCache.Upsert(item)
+	}
+
+	switch err {
+	case nil:
+	case cache.ErrPreconditionFailed:
+		ch.Resp(c, http.StatusPreconditionFailed, gin.H{"message": "Precondition failed"})
+		return
+	default:
+		ch.Resp(c, http.StatusInsufficientStorage, gin.H{"message": "Item was not stored - rejected by admission policy or bigger than maxBytes"})
+		return
+	}
+	c.Header("ETag", etag(version))
+	ch.Resp(c, http.StatusOK, gin.H{"data": item, "version": version})
+}
+
+// Atomically increments integer value of the item by `delta` (1 by default)
+func (ch *CacheHandler) IncrItem(c *gin.Context) {
+	var req IncrRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			ch.Resp(c, http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+	}
+	delta := int64(1)
+	if req.Delta != nil {
+		delta = *req.Delta
+	}
+
+	value, err := ch.cacheOf(c).Incr(c.Param("key"), delta)
+	if err == cache.ErrNotStored {
+		ch.Resp(c, http.StatusInsufficientStorage, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		ch.Resp(c, http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	}
+	ch.Resp(c, http.StatusOK, gin.H{"data": gin.H{"key": c.Param("key"), "value": value}})
+}
+
+func (ch *CacheHandler) TouchItem(c *gin.Context) {
+	if !ch.cacheOf(c).Touch(c.Param("key")) {
 		ch.Resp(c, http.StatusNotFound, gin.H{"message": "Item not found"})
 		return
 	}
-	ch.Resp(c, http.StatusOK, gin.H{"data": item})
+	ch.Resp(c, http.StatusOK, gin.H{})
 }
 
 func (ch *CacheHandler) DeleteItem(c *gin.Context) {
-	ch.cache.RemoveItem(c.Param("key"))
+	ch.cacheOf(c).RemoveItem(c.Param("key"))
 	ch.Resp(c, http.StatusOK, gin.H{})
 }
 
 func (ch *CacheHandler) CacheOverview(c *gin.Context) {
+	nsCache := ch.cacheOf(c)
+	stats := nsCache.Stats()
 	data := gin.H{
-		"config":              ch.cache.Config,
-		"size":                ch.cache.Size(),
-		"isUnlimitedCapacity": ch.cache.Config.Capacity == 0,
+		"config":              nsCache.Config,
+		"size":                nsCache.Size(),
+		"stats":               stats,
+		"isUnlimitedCapacity": nsCache.Config.Capacity == 0,
 		"usedPercentage":      0,
+		"usedBytes":           stats.UsedBytes,
+		"maxBytes":            nsCache.Config.MaxBytes,
+		"usedBytesPercentage": 0,
+	}
+	if nsCache.Config.Capacity > 0 {
+		data["usedPercentage"] = int((100.0 / float64(nsCache.Config.Capacity)) * float64(nsCache.Size()))
 	}
-	if ch.cache.Config.Capacity > 0 {
-		data["usedPercentage"] = int((100.0 / float64(ch.cache.Config.Capacity)) * float64(ch.cache.Size()))
+	if nsCache.Config.MaxBytes > 0 {
+		data["usedBytesPercentage"] = int((100.0 / float64(nsCache.Config.MaxBytes)) * float64(stats.UsedBytes))
 	}
 	ch.Resp(c, http.StatusOK, gin.H{"data": data})
 }
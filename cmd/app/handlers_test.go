@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func prepareAPI(cfg *config) *gin.Engine {
+	cfg.AllowedAccounts = []string{"user:secret"}
+	cfg.TTL = 100
+	registry, _ := initRegistry(cfg)
+	return initAPI(cfg, registry)
+}
+
+func request(router *gin.Engine, method string, url string, body string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	req.SetBasicAuth("user", "secret")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func responseOf(w *httptest.ResponseRecorder) map[string]interface{} {
+	resp := map[string]interface{}{}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return resp
+}
+
+func TestSetItem_Conditional(t *testing.T) {
+	router := prepareAPI(&config{})
+
+	w := request(router, "PUT", "/cache/a", `{"value":"1"}`, map[string]string{"If-None-Match": "*"})
+	assert.Equal(t, http.StatusOK, w.Code, "missing item should be added")
+	version := w.Header().Get("ETag")
+	assert.NotEmpty(t, version, "version should be in ETag header")
+
+	w = request(router, "PUT", "/cache/a", `{"value":"2"}`, map[string]string{"If-None-Match": "*"})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code, "existing item shouldnt be added again")
+	w = request(router, "PUT", "/cache/a", `{"value":"2"}`, map[string]string{"If-Match": `"12345"`})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code, "item with other version shouldnt be replaced")
+	w = request(router, "PUT", "/cache/missing", `{"value":"2"}`, map[string]string{"If-Match": "*"})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code, "missing item shouldnt be replaced")
+
+	w = request(router, "PUT", "/cache/a", `{"value":"2"}`, map[string]string{"If-Match": version})
+	assert.Equal(t, http.StatusOK, w.Code, "item with the same version should be replaced")
+	assert.NotEqual(t, version, w.Header().Get("ETag"), "replaced item should get new version")
+
+	w = request(router, "PUT", "/cache/a", `{"value":"3"}`, map[string]string{"If-Match": "abc"})
+	assert.Equal(t, http.StatusBadRequest, w.Code, "invalid If-Match header should be rejected")
+	w = request(router, "PUT", "/cache/a", `{"value":"3"}`, map[string]string{"If-None-Match": version})
+	assert.Equal(t, http.StatusBadRequest, w.Code, "If-None-Match other than * should be rejected")
+
+	w = request(router, "GET", "/cache/a", "", nil)
+	assert.Equal(t, "2", responseOf(w)["data"].(map[string]interface{})["value"], "failed preconditions shouldnt change the item")
+}
+
+func TestSetItem_NotStored(t *testing.T) {
+	router := prepareAPI(&config{MaxBytes: 10})
+
+	w := request(router, "PUT", "/cache/big", `{"value":"`+strings.Repeat("x", 100)+`"}`, nil)
+	assert.Equal(t, http.StatusInsufficientStorage, w.Code, "item bigger than MaxBytes should be rejected")
+	w = request(router, "GET", "/cache/big", "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code, "rejected item shouldnt be stored")
+
+	w = request(router, "PUT", "/cache/a", `{"value":"1","ttl":-5}`, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "invalid TTL should be rejected")
+}
+
+func TestIncrItem(t *testing.T) {
+	router := prepareAPI(&config{MaxBytes: 10})
+
+	w := request(router, "POST", "/cache/c/incr", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code, "missing counter should be created")
+	w = request(router, "POST", "/cache/c/incr", `{"delta":-3}`, nil)
+	assert.Equal(t, float64(-2), responseOf(w)["data"].(map[string]interface{})["value"], "counter should be decremented")
+
+	w = request(router, "POST", "/cache/c/incr", `{"delta":1000000000000000}`, nil)
+	assert.Equal(t, http.StatusInsufficientStorage, w.Code, "value bigger than MaxBytes should be rejected")
+
+	request(router, "PUT", "/cache/t", `{"value":"text"}`, nil)
+	w = request(router, "POST", "/cache/t/incr", "", nil)
+	assert.Equal(t, http.StatusConflict, w.Code, "non-numeric value shouldnt be incremented")
+	w = request(router, "POST", "/cache/c/incr", `{"delta":"x"}`, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "invalid body should be rejected")
+}
+
+func TestTransaction(t *testing.T) {
+	router := prepareAPI(&config{MaxBytes: 20})
+	request(router, "PUT", "/cache/a", `{"value":"1"}`, nil)
+
+	w := request(router, "POST", "/cache/tx", `{"operations":[{"op":"set","item":{"key":"b","value":"2"}},{"op":"get","key":"a"},{"op":"get","key":"b"}]}`, nil)
+	assert.Equal(t, http.StatusOK, w.Code, "transaction should be applied")
+	results := responseOf(w)["data"].([]interface{})
+	assert.Equal(t, 2, len(results), "results of get operations should be returned")
+	assert.Equal(t, true, results[1].(map[string]interface{})["found"], "own writes should be seen by the transaction")
+
+	w = request(router, "POST", "/cache/tx", `{"operations":[{"op":"delete","key":"a"},{"op":"set","item":{"key":"big","value":"`+strings.Repeat("x", 100)+`"}}]}`, nil)
+	assert.Equal(t, http.StatusInsufficientStorage, w.Code, "transaction with rejected item should fail")
+	w = request(router, "GET", "/cache/a", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code, "nothing should be applied when transaction fails")
+
+	w = request(router, "POST", "/cache/tx", `{"operations":[{"op":"delete","key":"a"},{"op":"bad"}]}`, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "unknown operation should be rejected")
+	w = request(router, "POST", "/cache/tx", `{"operations":[{"op":"set","item":{"key":"export","value":"1"}}]}`, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "reserved key shouldnt be set")
+	w = request(router, "GET", "/cache/a", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code, "nothing should be applied when transaction fails")
+}
+
+func TestReservedKeys(t *testing.T) {
+	router := prepareAPI(&config{Namespaces: []string{"orders"}})
+
+	w := request(router, "POST", "/cache/tx", `{"operations":[{"op":"get","key":"a"}]}`, nil)
+	assert.Equal(t, http.StatusOK, w.Code, "POST /cache/tx should go to transaction")
+	w = request(router, "POST", "/ns/orders/cache/tx", `{"operations":[{"op":"get","key":"a"}]}`, nil)
+	assert.Equal(t, http.StatusOK, w.Code, "reserved keys should be dispatched in namespaces too")
+	w = request(router, "GET", "/cache/export", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code, "GET /cache/export should go to export")
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"), "export should be JSON Lines by default")
+	w = request(router, "POST", "/cache/import?format=kv", "a:1\n", nil)
+	assert.Equal(t, http.StatusOK, w.Code, "POST /cache/import should go to import")
+	w = request(router, "GET", "/cache/a", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code, "imported item should be found")
+
+	for _, req := range [][2]string{
+		{"GET", "/cache/tx"},
+		{"POST", "/cache/stream"},
+		{"PUT", "/cache/export"},
+		{"DELETE", "/cache/import"},
+		{"PATCH", "/cache/ws/touch"},
+		{"POST", "/cache/tx/incr"},
+	} {
+		w = request(router, req[0], req[1], `{"value":"1"}`, nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code, req[0]+" "+req[1]+" should be rejected")
+	}
+	w = request(router, "POST", "/cache/", `{"data":[{"key":"a","value":"2"},{"key":"stream","value":"1"}]}`, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "reserved key shouldnt be inserted")
+	w = request(router, "GET", "/cache/a", "", nil)
+	assert.Equal(t, "1", responseOf(w)["data"].(map[string]interface{})["value"], "nothing should be inserted with reserved key")
+}
+
+func TestScanItems(t *testing.T) {
+	router := prepareAPI(&config{})
+	request(router, "POST", "/cache/", `{"data":[{"key":"BTC:1","value":"1"},{"key":"BTC:2","value":"2"},{"key":"ETH:1","value":"3"}]}`, nil)
+
+	w := request(router, "GET", "/cache/?prefix=BTC:&limit=1", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code, "first page should be returned")
+	resp := responseOf(w)
+	assert.Equal(t, float64(1), resp["count"], "page should be limited")
+	cursor := resp["cursor"].(string)
+	assert.NotEmpty(t, cursor, "cursor of the next page should be returned")
+
+	w = request(router, "GET", "/cache/?prefix=BTC:&limit=1&cursor="+cursor, "", nil)
+	resp = responseOf(w)
+	assert.Equal(t, "BTC:2", resp["data"].([]interface{})[0].(map[string]interface{})["key"], "next page should continue after the cursor")
+
+	w = request(router, "GET", "/cache/?match=*:1", "", nil)
+	assert.Equal(t, float64(2), responseOf(w)["count"], "items should be matched by pattern")
+
+	for _, query := range []string{"limit=x", "limit=0", "limit=-1", "cursor=@@", "prefix=BTC&match=*"} {
+		w = request(router, "GET", "/cache/?"+query, "", nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query+" should be rejected")
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	router := prepareAPI(&config{Namespaces: []string{"orders"}})
+
+	w := request(router, "GET", "/ns/nope/cache/", "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code, "unknown namespace should be reported")
+	w = request(router, "PUT", "/ns/nope/cache/a", `{"value":"1"}`, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code, "items shouldnt be set in unknown namespace")
+
+	w = request(router, "PUT", "/ns/orders/cache/a", `{"value":"1"}`, nil)
+	assert.Equal(t, http.StatusOK, w.Code, "item should be set in the namespace")
+	w = request(router, "GET", "/cache/a", "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code, "item shouldnt be in other namespace")
+	w = request(router, "GET", "/ns/default/cache/a", "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code, "item shouldnt be in default namespace")
+	w = request(router, "GET", "/ns/orders/cache/a", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code, "item should be found in its namespace")
+}
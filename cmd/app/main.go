@@ -2,10 +2,16 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	cache "tohan.net/go-practice/src/cache"
 	types "tohan.net/go-practice/src/cache/types"
@@ -21,17 +27,46 @@ const CryptomoodServer = "internal-dev.api.cryptomood.com:30000"
 
 const RandomInputAdapterInterval = 10
 const RandomInputAdapterAmount = 7
+const RandomInputAdapterTTL = 0 // cache default
+
+const EvictionSpillFrequency = 5
+const EvictionSpillRetries = 3
+const EvictionSpillQueueSize = 10000 // evicted items are dropped when the disk can't keep up
 
 // int32 doesnt work with this package... bug
 type config struct {
 	IsDebug                  bool     `env:"DEBUG"`
-	Adapters                 []string `env:"ADAPTERS" envDefault:"" envSeparator:","`
+	Adapters                 []string `env:"ADAPTERS" envDefault:"" envSeparator:","`   // `name[:namespace]`
+	Namespaces               []string `env:"NAMESPACES" envDefault:"" envSeparator:","` // just the default one by default
 	TTL                      int64    `env:"TTL" envDefault:"100"`
-	Capacity                 int64    `env:"CAPACITY" envDefault:"0"` // unlimited by default
+	Capacity                 int64    `env:"CAPACITY" envDefault:"0"`  // unlimited by default
+	MaxBytes                 int64    `env:"MAX_BYTES" envDefault:"0"` // unlimited by default
 	ExpirationCheckFrequency int64    `env:"EXPIRATION_CHECK_FREQUENCY" envDefault:"25"`
 	GetAdaptersDataFrequency int64    `env:"GET_ADAPTERS_DATA_FREQUENCY" envDefault:"10"`
 	AdaptersBufferSize       int64    `env:"ADAPTERS_BUFFER_SIZE" envDefault:"0"` // unlimited by default
+	EvictionPolicy           string   `env:"EVICTION_POLICY" envDefault:"lru"`
+	AdmissionPolicy          string   `env:"ADMISSION_POLICY" envDefault:""` // everything is admitted by default
+	SlidingExpiration        bool     `env:"SLIDING_EXPIRATION"`
+	StaleGracePeriod         int64    `env:"STALE_GRACE_PERIOD" envDefault:"0"`
+	NegativeTTL              int64    `env:"NEGATIVE_TTL" envDefault:"0"`
+	BackingStoreDir          string   `env:"BACKING_STORE_DIR" envDefault:""`           // no backing store by default
+	WriteBehindFrequency     int64    `env:"WRITE_BEHIND_FREQUENCY" envDefault:"0"`     // 0 for write-through
+	WriteBehindQueueSize     int64    `env:"WRITE_BEHIND_QUEUE_SIZE" envDefault:"1000"` // 0 for unlimited
+	WriteBehindRetries       int      `env:"WRITE_BEHIND_RETRIES" envDefault:"3"`
+	SnapshotFile             string   `env:"SNAPSHOT_FILE" envDefault:""`        // no snapshots by default
+	SnapshotFrequency        int64    `env:"SNAPSHOT_FREQUENCY" envDefault:"60"` // 0 to save it just on exit
+	WALFile                  string   `env:"WAL_FILE" envDefault:""`             // no write-ahead log by default
+	WALSync                  string   `env:"WAL_SYNC" envDefault:"everysec"`
+	WALCompactFrequency      int64    `env:"WAL_COMPACT_FREQUENCY" envDefault:"300"` // 0 disables compaction
+	EvictionSpillDir         string   `env:"EVICTION_SPILL_DIR" envDefault:""`       // evicted items are dropped by default
+	WatchBufferSize          int64    `env:"WATCH_BUFFER_SIZE" envDefault:"100"`
+	EventHistorySize         int64    `env:"EVENT_HISTORY_SIZE" envDefault:"1000"` // 0 turns off resuming of streams
+	SeedFile                 string   `env:"SEED_FILE" envDefault:""`              // no seed by default
+	SeedFormat               string   `env:"SEED_FORMAT" envDefault:""`            // by extension of the file by default
+	SentimentsTTL            int64    `env:"SENTIMENTS_TTL" envDefault:"0"`        // cache default
+	SentimentsNamespace      string   `env:"SENTIMENTS_NAMESPACE" envDefault:"default"`
 	AllowedAccounts          []string `env:"ALLOWED_ACCOUNTS" envDefault:"" envSeparator:","`
+	AllowedOrigins           []string `env:"ALLOWED_ORIGINS" envDefault:"" envSeparator:","` // of WebSocket besides the API host
 }
 
 func envConfig() *config {
@@ -48,35 +83,246 @@ func envConfig() *config {
 	return &cfg
 }
 
-func initCache(cfg *config) *cache.Cache {
+// Config of the namespace. Global values can be overridden by `NS_<NAME>_TTL`, `NS_<NAME>_CAPACITY`,
+// `NS_<NAME>_MAX_BYTES` and `NS_<NAME>_EVICTION_POLICY`.
+func namespaceConfig(cfg *config, name string) types.CacheConfig {
 	config := types.CacheConfig{
 		TTL:                      int32(cfg.TTL), // conversion because of a bug in `env` ppackage
 		Capacity:                 cfg.Capacity,
+		MaxBytes:                 cfg.MaxBytes,
 		ExpCheckFrequency:        int32(cfg.ExpirationCheckFrequency),
 		GetAdaptersDataFrequency: int32(cfg.GetAdaptersDataFrequency),
 		AdaptersBufferSize:       cfg.AdaptersBufferSize,
+		EvictionPolicy:           cfg.EvictionPolicy,
+		AdmissionPolicy:          cfg.AdmissionPolicy,
+		SlidingExpiration:        cfg.SlidingExpiration,
+		StaleGracePeriod:         int32(cfg.StaleGracePeriod),
+		NegativeTTL:              int32(cfg.NegativeTTL),
+		WatchBufferSize:          int32(cfg.WatchBufferSize),
+		EventHistorySize:         int32(cfg.EventHistorySize),
+	}
+
+	prefix := "NS_" + strings.ToUpper(strings.Replace(name, "-", "_", -1)) + "_"
+	override := func(key string, apply func(value int64)) {
+		value := os.Getenv(prefix + key)
+		if value == "" {
+			return
+		}
+		number, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			log.Fatalf("Invalid %s%s: %s", prefix, key, value)
+		}
+		apply(number)
+	}
+	override("TTL", func(value int64) { config.TTL = int32(value) })
+	override("CAPACITY", func(value int64) { config.Capacity = value })
+	override("MAX_BYTES", func(value int64) { config.MaxBytes = value })
+	if policy := os.Getenv(prefix + "EVICTION_POLICY"); policy != "" {
+		config.EvictionPolicy = policy
+	}
+	return config
+}
+
+// Files and directories of other namespaces than the default one get its name as a suffix,
+// e.g. `cache.snapshot` -> `cache.orders.snapshot`
+func namespacePath(path string, name string) string {
+	if path == "" || name == cache.DefaultNamespace {
+		return path
 	}
-	c := cache.NewCache(config)
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + name + ext
+}
 
-	// Set adapters.
-	for _, adapterName := range cfg.Adapters {
+// Returns also write-behind stores, which have to be closed on exit so their queued writes are not lost.
+func initRegistry(cfg *config) (*cache.Registry, []io.Closer) {
+	registry := cache.NewRegistry()
+	stores := []io.Closer{}
+	for _, name := range append([]string{cache.DefaultNamespace}, cfg.Namespaces...) {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, found := registry.Get(name); found {
+			continue
+		}
+		c, err := registry.Create(name, namespaceConfig(cfg, name))
+		if err != nil {
+			log.Fatal(err)
+		}
+		stores = append(stores, initNamespace(cfg, name, c)...)
+	}
+
+	// Set adapters, `name:namespace` puts data into the chosen namespace.
+	for _, adapter := range cfg.Adapters {
+		adapterName, namespace := adapter, cache.DefaultNamespace
+		if i := strings.Index(adapter, ":"); i >= 0 {
+			adapterName, namespace = adapter[:i], adapter[i+1:]
+		}
+		c, found := registry.Get(namespace)
+		if !found {
+			log.Fatalf("Unknown namespace of adapter %s: %s", adapterName, namespace)
+		}
 		if adapterName == "input" {
 			c.SetInputAdapter(cache.NewCommandLineInputAdapter(os.Stdin, cfg.AdaptersBufferSize))
 		} else if adapterName == "random" {
-			c.SetInputAdapter(cache.NewRandomInputAdapter(RandomInputAdapterInterval, RandomInputAdapterAmount, cfg.AdaptersBufferSize))
+			c.SetInputAdapter(cache.NewRandomInputAdapter(RandomInputAdapterInterval, RandomInputAdapterAmount, RandomInputAdapterTTL, cfg.AdaptersBufferSize))
 		}
 	}
-	return c
+	return registry, stores
 }
 
-func initAPI(cfg *config, c *cache.Cache) *gin.Engine {
+// Returns write-behind stores of the namespace
+func initNamespace(cfg *config, name string, c *cache.Cache) []io.Closer {
+	stores := []io.Closer{}
+	// Persist items into the directory and load missing ones from there.
+	if cfg.BackingStoreDir != "" {
+		store, err := cache.NewFileStore(namespacePath(cfg.BackingStoreDir, name))
+		if err != nil {
+			log.Fatal(err)
+		}
+		c.SetLoader(store.Load)
+		if cfg.WriteBehindFrequency > 0 {
+			writeBehind := cache.NewWriteBehindStore(store, int32(cfg.WriteBehindFrequency), cfg.WriteBehindQueueSize, cfg.WriteBehindRetries)
+			c.SetBackingStore(writeBehind)
+			stores = append(stores, writeBehind)
+		} else {
+			c.SetBackingStore(store)
+		}
+	}
+
+	// Save evicted items into the directory. Write-behind, so the cache is not blocked by the disk.
+	if cfg.EvictionSpillDir != "" {
+		store, err := cache.NewFileStore(namespacePath(cfg.EvictionSpillDir, name))
+		if err != nil {
+			log.Fatal(err)
+		}
+		spill := cache.NewWriteBehindStore(store, EvictionSpillFrequency, EvictionSpillQueueSize, EvictionSpillRetries)
+		stores = append(stores, spill)
+		c.OnEvict(func(item types.CacheItem, reason string) {
+			if err := spill.Set(item); err != nil {
+				log.Print("Evicted item can't be saved: ", err)
+			}
+		})
+	}
+
+	// Load items saved before restart.
+	if cfg.SnapshotFile != "" {
+		if err := c.RestoreFromFile(namespacePath(cfg.SnapshotFile, name)); err == nil {
+			log.Printf("Restored %d items of %s from snapshot", c.Size(), name)
+		} else if !os.IsNotExist(err) {
+			log.Print("Snapshot can't be restored: ", err)
+		}
+	}
+
+	// Replay writes since the snapshot and log the next ones.
+	if cfg.WALFile != "" {
+		if err := c.OpenWAL(namespacePath(cfg.WALFile, name), cfg.WALSync, int32(cfg.WALCompactFrequency)); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Namespace %s has %d items after replay of write-ahead log", name, c.Size())
+	}
+
+	// Insert initial items which are not in the cache yet. Only the default namespace is seeded.
+	if cfg.SeedFile != "" && name == cache.DefaultNamespace {
+		format := cfg.SeedFormat
+		if format == "" {
+			format = seedFormat(cfg.SeedFile)
+		}
+		result, err := c.ImportFromFile(cfg.SeedFile, format, cache.ImportSkipExisting)
+		if err != nil {
+			log.Print("Seed file can't be imported: ", err)
+		}
+		log.Printf("Seeded %d items (%d existing skipped, %d rejected, %d failed)", result.Imported, result.Skipped, result.Rejected, result.Failed)
+		for _, importErr := range result.Errors {
+			log.Printf("Seed file line %d: %s", importErr.Line, importErr.Message)
+		}
+	}
+	return stores
+}
+
+// `.jsonl` and `.csv` files are imported as they are, others are `KEY:VALUE` lines
+func seedFormat(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".jsonl", ".ndjson":
+		return cache.ImportJSONLines
+	case ".csv":
+		return cache.ImportCSV
+	default:
+		return cache.ImportKeyValue
+	}
+}
+
+// Saves snapshots periodically and on exit, closes write-ahead logs and flushes write-behind stores on exit
+func initPersistence(cfg *config, registry *cache.Registry, stores []io.Closer) {
+	save := func() {
+		if cfg.SnapshotFile == "" {
+			return
+		}
+		for _, name := range registry.Names() {
+			c, _ := registry.Get(name)
+			if err := c.SnapshotToFile(namespacePath(cfg.SnapshotFile, name)); err != nil {
+				log.Print("Snapshot can't be saved: ", err)
+			}
+		}
+	}
+
+	if cfg.SnapshotFile != "" && cfg.SnapshotFrequency > 0 {
+		go func() {
+			for range time.Tick(time.Duration(cfg.SnapshotFrequency) * time.Second) {
+				save()
+			}
+		}()
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		save()
+		for _, name := range registry.Names() {
+			c, _ := registry.Get(name)
+			if err := c.CloseWAL(); err != nil {
+				log.Print("Write-ahead log can't be closed: ", err)
+			}
+		}
+		for _, store := range stores {
+			if err := store.Close(); err != nil {
+				log.Print("Write-behind queue can't be flushed: ", err)
+			}
+		}
+		os.Exit(0)
+	}()
+}
+
+// Endpoints of one namespace
+func cacheRoutes(group *gin.RouterGroup, env *CacheHandler) {
+	group.GET("/cache/", env.GetAllItems)
+	group.POST("/cache/", env.AddItems)
+	group.DELETE("/cache/", env.DeleteAllItems)
+	group.GET("/cache/:key", env.withReservedKeys(env.GetItem, map[string]gin.HandlerFunc{
+		"export": env.Export,
+		"stream": env.Stream,
+		"ws":     env.WebSocket,
+	}))
+	group.POST("/cache/:key", env.withReservedKeys(env.SetItem, map[string]gin.HandlerFunc{
+		"tx":     env.Transaction,
+		"import": env.Import,
+	}))
+	group.PUT("/cache/:key", env.withReservedKeys(env.SetItem, nil))
+	group.DELETE("/cache/:key", env.withReservedKeys(env.DeleteItem, nil))
+	group.PATCH("/cache/:key/touch", env.withReservedKeys(env.TouchItem, nil))
+	group.POST("/cache/:key/incr", env.withReservedKeys(env.IncrItem, nil))
+	group.GET("/overview", env.CacheOverview)
+}
+
+func initAPI(cfg *config, registry *cache.Registry) *gin.Engine {
 	// Configure API
 	if cfg.IsDebug {
 		gin.SetMode(gin.DebugMode)
 	} else {
 		gin.SetMode(gin.ReleaseMode)
 	}
-	env := &CacheHandler{c}
+	env := &CacheHandler{registry: registry, allowedOrigins: cfg.AllowedOrigins}
 	router := gin.Default()
 
 	// init group allowed accounts
@@ -89,12 +335,10 @@ func initAPI(cfg *config, c *cache.Cache) *gin.Engine {
 	// protect endpoints
 	authorized := router.Group("/", gin.BasicAuth(allowedAccounts))
 	{
-		authorized.GET("/cache/", env.GetAllItems)
-		authorized.POST("/cache/", env.AddItems)
-		authorized.DELETE("/cache/", env.DeleteAllItems)
-		authorized.GET("/cache/:key", env.GetItem)
-		authorized.DELETE("/cache/:key", env.DeleteItem)
-		authorized.GET("/overview", env.CacheOverview)
+		authorized.GET("/ns", env.Namespaces)
+		// routes without namespace use the default one
+		cacheRoutes(authorized.Group("", env.Namespace), env)
+		cacheRoutes(authorized.Group("/ns/:namespace", env.Namespace), env)
 	}
 
 	router.GET("/ping", func(c *gin.Context) {
@@ -106,10 +350,16 @@ func initAPI(cfg *config, c *cache.Cache) *gin.Engine {
 
 func main() {
 	cfg := envConfig()
-	c := initCache(cfg)
+	registry, stores := initRegistry(cfg)
+	initPersistence(cfg, registry, stores)
+
+	c, found := registry.Get(cfg.SentimentsNamespace)
+	if !found {
+		log.Fatal("Unknown namespace of sentiments: ", cfg.SentimentsNamespace)
+	}
 
 	// subscribe to sentiment API to and save records into the cache...
-	go crypto.ConsumeSentiments(c, CryptomoodCertFile, CryptomoodServer)
+	go crypto.ConsumeSentiments(c, CryptomoodCertFile, CryptomoodServer, int32(cfg.SentimentsTTL))
 
-	initAPI(cfg, c).Run(":8080")
+	initAPI(cfg, registry).Run(":8080")
 }
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+
+	cache "tohan.net/go-practice/src/cache"
+	types "tohan.net/go-practice/src/cache/types"
+)
+
+// How often idle streams are pinged, so proxies don't close them
+const StreamPingInterval = 15 * time.Second
+
+// Reasons of `reset` event. Client should reload all items by `GET /cache/` after it.
+const (
+	ResetMissed  = "missed"  // events after the last event ID are not kept anymore
+	ResetDropped = "dropped" // client was too slow and some events were dropped
+)
+
+// Sent instead of an event when client missed some of them
+type StreamReset struct {
+	Type        string `json:"type"` // always `reset`
+	Reason      string `json:"reason"`
+	LastEventID uint64 `json:"lastEventId"`
+}
+
+// Writes events into one kind of stream
+type eventSink interface {
+	Event(event types.CacheEvent) error
+	Reset(reset StreamReset) error
+	Ping() error
+}
+
+// Last event ID from `Last-Event-ID` header (sent by browsers on reconnect) or `?lastEventId=`
+func lastEventID(c *gin.Context) (uint64, bool) {
+	value := c.GetHeader("Last-Event-ID")
+	if value == "" {
+		value = c.Query("lastEventId")
+	}
+	if value == "" {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(value, 10, 64)
+	return id, err == nil
+}
+
+// Sends events of the `prefix` into the sink until it fails or `done` is closed.
+func (ch *CacheHandler) streamEvents(c *cache.Cache, prefix string, fromID uint64, resume bool, done <-chan struct{}, sink eventSink) {
+	var watcher *cache.Watcher
+	lastID := fromID
+	if resume {
+		var complete bool
+		watcher, complete = c.WatchFrom(prefix, fromID)
+		if !complete {
+			// client reloads all items, the kept events are older
+			watcher.Close()
+			watcher = c.Watch(prefix)
+			if sink.Reset(StreamReset{Type: "reset", Reason: ResetMissed, LastEventID: lastID}) != nil {
+				watcher.Close()
+				return
+			}
+		}
+	} else {
+		watcher = c.Watch(prefix)
+	}
+	// watcher is replaced after drop
+	defer func() { watcher.Close() }()
+
+	ping := time.NewTicker(StreamPingInterval)
+	defer ping.Stop()
+	for {
+		var err error
+		select {
+		case <-done:
+			return
+		case <-ping.C:
+			err = sink.Ping()
+		case event, open := <-watcher.Events:
+			if !open {
+				return
+			}
+			if watcher.Dropped() > 0 {
+				// buffered events are older than items client reloads after reset, so they are thrown away
+				watcher.Close()
+				watcher = c.Watch(prefix)
+				err = sink.Reset(StreamReset{Type: "reset", Reason: ResetDropped, LastEventID: lastID})
+			} else {
+				err = sink.Event(event)
+				lastID = event.ID
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+type sseSink struct {
+	w gin.ResponseWriter
+}
+
+func (sink sseSink) write(id uint64, name string, data interface{}) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id > 0 {
+		fmt.Fprintf(sink.w, "id: %d\n", id)
+	}
+	if _, err := fmt.Fprintf(sink.w, "event: %s\ndata: %s\n\n", name, encoded); err != nil {
+		return err
+	}
+	sink.w.Flush()
+	return nil
+}
+
+func (sink sseSink) Event(event types.CacheEvent) error {
+	return sink.write(event.ID, event.Type, event)
+}
+
+func (sink sseSink) Reset(reset StreamReset) error {
+	return sink.write(0, reset.Type, reset)
+}
+
+func (sink sseSink) Ping() error {
+	if _, err := fmt.Fprint(sink.w, ": ping\n\n"); err != nil {
+		return err
+	}
+	sink.w.Flush()
+	return nil
+}
+
+// Server-Sent Events with changes of items, `?prefix=` filters keys.
+// Event name is its type (`set`, `delete`, `expire`, `evict` or `reset`), data is JSON.
+func (ch *CacheHandler) Stream(c *gin.Context) {
+	fromID, resume := lastEventID(c)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // nginx would buffer the stream
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	ch.streamEvents(ch.cacheOf(c), c.Query("prefix"), fromID, resume, c.Request.Context().Done(), sseSink{c.Writer})
+}
+
+type websocketSink struct {
+	conn *websocket.Conn
+}
+
+func (sink websocketSink) Event(event types.CacheEvent) error {
+	return websocket.JSON.Send(sink.conn, event)
+}
+
+func (sink websocketSink) Reset(reset StreamReset) error {
+	return websocket.JSON.Send(sink.conn, reset)
+}
+
+func (sink websocketSink) Ping() error {
+	return websocket.Message.Send(sink.conn, `{"type":"ping"}`)
+}
+
+// WebSocket with changes of items as JSON messages. Same parameters as `Stream`.
+func (ch *CacheHandler) WebSocket(c *gin.Context) {
+	fromID, resume := lastEventID(c)
+	prefix := c.Query("prefix")
+	nsCache := ch.cacheOf(c)
+
+	server := websocket.Server{Handshake: ch.checkOrigin, Handler: func(conn *websocket.Conn) {
+		done := make(chan struct{})
+		go func() {
+			// client doesn't send anything, reading just detects closed connection
+			var message string
+			for websocket.Message.Receive(conn, &message) == nil {
+			}
+			close(done)
+		}()
+		ch.streamEvents(nsCache, prefix, fromID, resume, done, websocketSink{conn})
+	}}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+// Browsers send basic auth credentials also with WebSocket handshakes of other sites, so just the API host
+// and `ALLOWED_ORIGINS` are accepted. Clients which are not browsers don't send `Origin` at all.
+func (ch *CacheHandler) checkOrigin(config *websocket.Config, req *http.Request) error {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	originURL, err := url.Parse(origin)
+	if err != nil {
+		return err
+	}
+	if originURL.Host == req.Host {
+		return nil
+	}
+	for _, allowed := range ch.allowedOrigins {
+		if origin == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("origin %s is not allowed", origin)
+}
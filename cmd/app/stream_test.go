@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	cache "tohan.net/go-practice/src/cache"
+	types "tohan.net/go-practice/src/cache/types"
+)
+
+// Records what was sent, `Event` can be blocked by `gate` to simulate slow client
+type recordingSink struct {
+	sent    []string
+	entered chan string
+	gate    chan struct{}
+	sync.Mutex
+}
+
+func newRecordingSink() *recordingSink {
+	return &recordingSink{entered: make(chan string, 100), gate: make(chan struct{}, 100)}
+}
+
+func (sink *recordingSink) record(sent string) {
+	sink.Lock()
+	sink.sent = append(sink.sent, sent)
+	sink.Unlock()
+	sink.entered <- sent
+}
+
+func (sink *recordingSink) Event(event types.CacheEvent) error {
+	sink.record(event.Type + " " + event.Key)
+	<-sink.gate
+	return nil
+}
+
+func (sink *recordingSink) Reset(reset StreamReset) error {
+	sink.record("reset " + reset.Reason)
+	return nil
+}
+
+func (sink *recordingSink) Ping() error {
+	return nil
+}
+
+func (sink *recordingSink) Sent() []string {
+	sink.Lock()
+	defer sink.Unlock()
+
+	return append([]string{}, sink.sent...)
+}
+
+func waitFor(t *testing.T, sink *recordingSink, sent string) {
+	select {
+	case got := <-sink.entered:
+		assert.Equal(t, sent, got, "unexpected message of the stream")
+	case <-time.After(time.Second):
+		t.Fatal("stream didnt send " + sent)
+	}
+}
+
+func TestStreamEvents_DroppedEventsAreNotDelivered(t *testing.T) {
+	c := cache.NewCache(types.CacheConfig{TTL: 100, WatchBufferSize: 1})
+	ch := &CacheHandler{}
+	sink := newRecordingSink()
+	done := make(chan struct{})
+	defer close(done)
+	go ch.streamEvents(c, "", 0, false, done, sink)
+
+	// watcher is subscribed in the goroutine
+	assert.Eventually(t, func() bool {
+		c.AddItem(types.CacheItem{Key: "1", Value: "1"})
+		return len(sink.Sent()) > 0
+	}, time.Second, 10*time.Millisecond, "stream should get the first event")
+	waitFor(t, sink, "set 1")
+
+	// client is stuck in the first event, second one is buffered and third one dropped
+	c.AddItem(types.CacheItem{Key: "2", Value: "2"})
+	c.AddItem(types.CacheItem{Key: "3", Value: "3"})
+	sink.gate <- struct{}{}
+	waitFor(t, sink, "reset dropped")
+
+	c.AddItem(types.CacheItem{Key: "4", Value: "4"})
+	waitFor(t, sink, "set 4")
+	sink.gate <- struct{}{}
+	assert.Equal(t, []string{"set 1", "reset dropped", "set 4"}, sink.Sent(), "buffered events older than reset shouldnt be sent")
+}
+
+func TestStreamEvents_MissedEventsAreNotDelivered(t *testing.T) {
+	c := cache.NewCache(types.CacheConfig{TTL: 100, EventHistorySize: 2})
+	for i := 0; i < 5; i++ {
+		c.AddItem(types.CacheItem{Key: "old", Value: "1"})
+	}
+	ch := &CacheHandler{}
+	sink := newRecordingSink()
+	done := make(chan struct{})
+	defer close(done)
+	go ch.streamEvents(c, "", 1, true, done, sink)
+	waitFor(t, sink, "reset missed")
+
+	c.AddItem(types.CacheItem{Key: "new", Value: "1"})
+	waitFor(t, sink, "set new")
+	sink.gate <- struct{}{}
+	assert.Equal(t, []string{"reset missed", "set new"}, sink.Sent(), "kept events older than reset shouldnt be sent")
+}
+
+func TestCheckOrigin(t *testing.T) {
+	ch := &CacheHandler{allowedOrigins: []string{"https://dashboard.example.com"}}
+	check := func(origin string) error {
+		req := httptest.NewRequest("GET", "http://cache.example.com/cache/ws", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		return ch.checkOrigin(nil, req)
+	}
+
+	assert.Nil(t, check(""), "clients without origin (not browsers) should be accepted")
+	assert.Nil(t, check("https://cache.example.com"), "origin of the API host should be accepted")
+	assert.Nil(t, check("https://dashboard.example.com"), "allowed origin should be accepted")
+	assert.NotNil(t, check("https://evil.example.com"), "other sites shouldnt be accepted")
+}
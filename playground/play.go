@@ -25,8 +25,8 @@ func main() {
 	// - if normal stdin -> take input from user and wait for command `STOP` to stop reading
 	c.SetInputAdapter(cache.NewCommandLineInputAdapter(os.Stdin, 0))
 
-	// Generate 7 random items into the cache every 2 seconds
-	c.SetInputAdapter(cache.NewRandomInputAdapter(2, 7, 0))
+	// Generate 7 random items with default TTL into the cache every 2 seconds
+	c.SetInputAdapter(cache.NewRandomInputAdapter(2, 7, 0, 0))
 
 	time.Sleep(10 * time.Second)
 
@@ -2,6 +2,7 @@ package cache
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"math/rand"
@@ -41,7 +42,7 @@ func NewCommandLineInputAdapter(rd io.Reader, bufferSize int64) IAdapter {
 func (adapter *CommandLineInputAdapter) readFromStdin() {
 	fi, _ := os.Stdin.Stat()
 	if (fi.Mode() & os.ModeCharDevice) != 0 { // do not show if streamed via PIPE
-		fmt.Println("Enter items in format `KEY:VALUE` separated by `\n`. Stop reading with cmd `STOP`:")
+		fmt.Println("Enter items in format `KEY:VALUE` or `KEY:VALUE:TTL` separated by `\n`. Stop reading with cmd `STOP`:")
 	}
 	savedItemsCnt := int64(0)
 	for {
@@ -62,23 +63,44 @@ func (adapter *CommandLineInputAdapter) readFromStdin() {
 		}
 
 		// Parse text and check for correct data format
-		data := strings.Split(text, ":")
-		if err == nil && len(data) != 2 {
-			fmt.Println("Skipping. Key:Value pair in wrong format:", text)
+		item, err := parseKeyValue(text)
+		if err != nil {
+			fmt.Println("Skipping.", err.Error()+":", text)
 			continue
-		} else {
-			savedItemsCnt++
 		}
+		savedItemsCnt++
 
 		// save item
-		adapter.queue.Enq(types.CacheItem{
-			Key:   data[0],
-			Value: data[1],
-		})
+		adapter.queue.Enq(item)
 	}
 	fmt.Println("Number of collected items:", savedItemsCnt)
 }
 
+var (
+	errKeyValueFormat = errors.New("key:value pair in wrong format")
+	errTTLFormat      = errors.New("TTL in wrong format")
+)
+
+// Parses item in format `KEY:VALUE` or `KEY:VALUE:TTL`
+func parseKeyValue(text string) (types.CacheItem, error) {
+	data := strings.Split(text, ":")
+	if len(data) != 2 && len(data) != 3 {
+		return types.CacheItem{}, errKeyValueFormat
+	}
+	item := types.CacheItem{
+		Key:   data[0],
+		Value: data[1],
+	}
+	if len(data) == 3 {
+		ttl, err := strconv.ParseInt(strings.TrimSpace(data[2]), 10, 32)
+		item.TTL = int32(ttl)
+		if err != nil || !item.HasValidTTL() {
+			return types.CacheItem{}, errTTLFormat
+		}
+	}
+	return item, nil
+}
+
 func (adapter *CommandLineInputAdapter) GetData() []*types.CacheItem {
 	buffer := []*types.CacheItem{}
 
@@ -98,16 +120,18 @@ type RandomInputAdapter struct {
 	lastlyReturned int64
 	frequency      int32
 	amount         int32
+	ttl            int32 // TTL of generated items. 0 for cache default
 	sync.Mutex
 }
 
-func NewRandomInputAdapter(frequency int32, amount int32, bufferSize int64) IAdapter {
+func NewRandomInputAdapter(frequency int32, amount int32, ttl int32, bufferSize int64) IAdapter {
 	var adapter IAdapter = &RandomInputAdapter{
 		queue:          types.ItemsQueue{Capacity: bufferSize},
 		overallCounter: 0,
 		lastlyReturned: 0,
 		frequency:      frequency,
 		amount:         amount,
+		ttl:            ttl,
 	}
 	if frequency > 0 {
 		go executePeriodic(frequency, adapter.(*RandomInputAdapter).generateData)
@@ -145,6 +169,7 @@ func (adapter *RandomInputAdapter) generateData() {
 		adapter.queue.Enq(types.CacheItem{
 			Key:   strconv.Itoa(rand.Int()),
 			Value: strconv.Itoa(rand.Int()),
+			TTL:   adapter.ttl,
 		})
 	}
 }
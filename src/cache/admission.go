@@ -0,0 +1,169 @@
+package cache
+
+import (
+	"hash/fnv"
+
+	types "tohan.net/go-practice/src/cache/types"
+)
+
+// Decides if a new key is worth evicting another one when the cache is full.
+// Policies are not safe for concurrent use - cache calls them under its own lock.
+type IAdmissionPolicy interface {
+	Record(key string)                          // key was read or written
+	Admit(candidate string, victim string) bool // true if candidate should replace victim
+}
+
+// Returns policy by its name from config. Nil (everything is admitted) by default.
+func NewAdmissionPolicy(name string, capacity int64) IAdmissionPolicy {
+	switch name {
+	case types.AdmissionTinyLFU:
+		return newTinyLFUPolicy(capacity)
+	default:
+		return nil
+	}
+}
+
+// Admits candidate only if it was used more often than the victim recently (TinyLFU).
+// One-off keys (scans, imports) can't push out frequently used ones.
+type tinyLFUPolicy struct {
+	sketch *countMinSketch
+}
+
+func newTinyLFUPolicy(capacity int64) *tinyLFUPolicy {
+	return &tinyLFUPolicy{sketch: newCountMinSketch(capacity)}
+}
+
+func (p *tinyLFUPolicy) Record(key string) {
+	p.sketch.Increment(key)
+}
+
+func (p *tinyLFUPolicy) Admit(candidate string, victim string) bool {
+	return p.sketch.Estimate(candidate) > p.sketch.Estimate(victim)
+}
+
+// Records the write and asks admission policy if new item can evict another one.
+// Caller must hold the write lock.
+func (cache *Cache) admit(item types.CacheItem) bool {
+	if cache.admission == nil {
+		return true
+	}
+	cache.admission.Record(item.Key)
+	if cache.txAdmitted {
+		return true
+	}
+	if _, exists := cache.Store[item.Key]; exists || !cache.isFullFor(item) {
+		return true
+	}
+	victim, found := cache.eviction.Victim()
+	if !found {
+		return true
+	}
+	if !cache.admission.Admit(item.Key, victim) {
+		cache.stats.Rejected++
+		return false
+	}
+	cache.stats.Admitted++
+	return true
+}
+
+// Item can be stored - admission policy would admit it and it isn't bigger than `MaxBytes`.
+// Nothing is changed, not even frequencies. Caller must hold the write lock.
+func (cache *Cache) fits(item types.CacheItem) bool {
+	if cache.Config.MaxBytes > 0 && cache.sizeOf(item) > cache.Config.MaxBytes {
+		return false
+	}
+	if cache.admission == nil {
+		return true
+	}
+	if _, exists := cache.Store[item.Key]; exists || !cache.isFullFor(item) {
+		return true
+	}
+	victim, found := cache.eviction.Victim()
+	return !found || cache.admission.Admit(item.Key, victim)
+}
+
+// Something has to be evicted to save the new item. Caller must hold the lock.
+func (cache *Cache) isFullFor(item types.CacheItem) bool {
+	if cache.Config.Capacity > 0 && cache.Size() >= cache.Config.Capacity {
+		return true
+	}
+	return cache.Config.MaxBytes > 0 && cache.usedBytes+cache.sizeOf(item) > cache.Config.MaxBytes
+}
+
+const (
+	sketchDepth        = 4
+	sketchMaxCount     = 15 // 4-bit counters are enough to tell frequent keys
+	sketchSampleFactor = 10 // counters are halved after `width * sketchSampleFactor` increments
+	// Width of the sketch when capacity of the cache is unlimited
+	DefaultSketchWidth = 1024
+)
+
+// Count-Min sketch of key frequencies with aging, so old popularity fades away.
+type countMinSketch struct {
+	counters  [sketchDepth][]uint8
+	mask      uint32
+	additions int
+	resetAt   int
+}
+
+func newCountMinSketch(capacity int64) *countMinSketch {
+	width := uint32(DefaultSketchWidth)
+	if capacity > 0 {
+		// power of two, so index is computed by mask
+		width = 16
+		for int64(width) < capacity && width < 1<<30 {
+			width <<= 1
+		}
+	}
+	sketch := &countMinSketch{mask: width - 1, resetAt: int(width) * sketchSampleFactor}
+	for i := range sketch.counters {
+		sketch.counters[i] = make([]uint8, width)
+	}
+	return sketch
+}
+
+// Indexes of the key in all rows (double hashing)
+func (sketch *countMinSketch) indexes(key string) [sketchDepth]uint32 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	h1, h2 := uint32(sum), uint32(sum>>32)|1
+
+	indexes := [sketchDepth]uint32{}
+	for i := range indexes {
+		indexes[i] = (h1 + uint32(i)*h2) & sketch.mask
+	}
+	return indexes
+}
+
+func (sketch *countMinSketch) Increment(key string) {
+	for row, index := range sketch.indexes(key) {
+		if sketch.counters[row][index] < sketchMaxCount {
+			sketch.counters[row][index]++
+		}
+	}
+	sketch.additions++
+	if sketch.additions >= sketch.resetAt {
+		sketch.reset()
+	}
+}
+
+func (sketch *countMinSketch) Estimate(key string) uint8 {
+	min := uint8(sketchMaxCount)
+	for row, index := range sketch.indexes(key) {
+		if sketch.counters[row][index] < min {
+			min = sketch.counters[row][index]
+		}
+	}
+	return min
+}
+
+// Halves all counters
+func (sketch *countMinSketch) reset() {
+	for row := range sketch.counters {
+		for i := range sketch.counters[row] {
+			sketch.counters[row][i] >>= 1
+		}
+	}
+	sketch.additions /= 2
+}
@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	types "tohan.net/go-practice/src/cache/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCountMinSketch(t *testing.T) {
+	sketch := newCountMinSketch(16)
+
+	for i := 0; i < 5; i++ {
+		sketch.Increment("hot")
+	}
+	sketch.Increment("cold")
+	assert.Equal(t, uint8(5), sketch.Estimate("hot"), "frequency should be estimated")
+	assert.Equal(t, uint8(1), sketch.Estimate("cold"), "frequency should be estimated")
+	assert.Equal(t, uint8(0), sketch.Estimate("unknown"), "unknown key shouldnt have frequency")
+
+	for i := 0; i < 20; i++ {
+		sketch.Increment("hot")
+	}
+	assert.Equal(t, uint8(sketchMaxCount), sketch.Estimate("hot"), "counters should be capped")
+
+	sketch.reset()
+	assert.Equal(t, uint8(sketchMaxCount/2), sketch.Estimate("hot"), "counters should be halved by aging")
+	assert.Equal(t, uint8(0), sketch.Estimate("cold"), "counters should be halved by aging")
+}
+
+func TestCache_TinyLFUAdmission(t *testing.T) {
+	config := NewMockCache().Config
+	config.Capacity = 10
+	config.AdmissionPolicy = types.AdmissionTinyLFU
+	cache := NewCache(config)
+
+	for i := 0; i < 10; i++ {
+		key := "hot" + strconv.Itoa(i)
+		cache.AddItem(types.CacheItem{Key: key, Value: key})
+		cache.GetItem(key)
+		cache.GetItem(key)
+	}
+
+	// scan of one-off keys
+	for i := 0; i < 100; i++ {
+		key := "scan" + strconv.Itoa(i)
+		cache.AddItem(types.CacheItem{Key: key, Value: key})
+	}
+	for i := 0; i < 10; i++ {
+		_, found := cache.Store["hot"+strconv.Itoa(i)]
+		assert.True(t, found, "frequently used items shouldnt be evicted by scan")
+	}
+	assert.Equal(t, int64(100), cache.Stats().Rejected, "rejected items should be counted")
+
+	// newcomer which is asked for often enough is admitted
+	for i := 0; i < 5; i++ {
+		cache.GetItem("popular")
+	}
+	cache.AddItem(types.CacheItem{Key: "popular", Value: "1"})
+	_, found := cache.Store["popular"]
+	assert.True(t, found, "frequently requested item should be admitted")
+	assert.Equal(t, int64(1), cache.Stats().Admitted, "admitted items should be counted")
+	assert.Equal(t, int64(10), cache.Size(), "capacity should be kept")
+}
+
+func TestCache_NoAdmissionByDefault(t *testing.T) {
+	cache := prepareBrandNewCache()
+	cache.Config.Capacity = 1
+
+	cache.AddItem(types.CacheItem{Key: "1", Value: "1"})
+	cache.GetItem("1")
+	cache.AddItem(types.CacheItem{Key: "2", Value: "2"})
+	_, found := cache.Store["2"]
+	assert.True(t, found, "all items should be admitted without admission policy")
+}
+
+func TestCache_RejectedItemIsNotPersisted(t *testing.T) {
+	config := NewMockCache().Config
+	config.Capacity = 1
+	config.AdmissionPolicy = types.AdmissionTinyLFU
+	cache := NewCache(config)
+	store := NewMemoryStore()
+	cache.SetBackingStore(store)
+
+	cache.AddItem(types.CacheItem{Key: "hot", Value: "1"})
+	cache.GetItem("hot")
+	version := cache.version
+
+	_, err := cache.AddIfAbsent(types.CacheItem{Key: "cold", Value: "1"})
+	assert.Equal(t, ErrNotStored, err, "rejected item should be reported")
+	_, err = cache.Upsert(types.CacheItem{Key: "cold", Value: "1"})
+	assert.Equal(t, ErrNotStored, err, "rejected item should be reported")
+	_, found := store.Items["cold"]
+	assert.False(t, found, "rejected item shouldnt be written to backing store")
+	assert.Equal(t, version, cache.version, "rejected item shouldnt take a version")
+
+	result, _ := cache.Import(strings.NewReader("cold2:1\n"), ImportKeyValue, ImportOverwrite)
+	assert.Equal(t, 1, result.Rejected, "rejected item shouldnt be counted as imported")
+	assert.Equal(t, 0, result.Imported, "rejected item shouldnt be counted as imported")
+}
@@ -0,0 +1,406 @@
+package cache
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	types "tohan.net/go-practice/src/cache/types"
+)
+
+// Slower store behind the cache. Cache calls it on every write (write-through).
+// Wrap it by `NewWriteBehindStore` to make writes asynchronous.
+type IBackingStore interface {
+	Set(item types.CacheItem) error
+	Delete(key string) error
+	DeleteAll() error
+}
+
+// Set store which gets all writes to the cache. Evicted and expired items are not deleted from it.
+func (cache *Cache) SetBackingStore(store IBackingStore) {
+	cache.m.Lock()
+	defer cache.m.Unlock()
+
+	cache.backingStore = store
+}
+
+// Caller must hold the write lock.
+func (cache *Cache) writeThrough(item types.CacheItem) {
+	if cache.backingStore == nil {
+		return
+	}
+	if err := cache.backingStore.Set(item); err != nil {
+		fmt.Println("Saving of item to backing store failed:", item.Key, err)
+	}
+}
+
+// Caller must hold the write lock.
+func (cache *Cache) deleteThrough(key string) {
+	if cache.backingStore == nil {
+		return
+	}
+	if err := cache.backingStore.Delete(key); err != nil {
+		fmt.Println("Deleting of item from backing store failed:", key, err)
+	}
+}
+
+// Caller must hold the write lock.
+func (cache *Cache) deleteAllThrough() {
+	if cache.backingStore == nil {
+		return
+	}
+	if err := cache.backingStore.DeleteAll(); err != nil {
+		fmt.Println("Deleting of all items from backing store failed:", err)
+	}
+}
+
+type backingOp struct {
+	item      types.CacheItem
+	delete    bool
+	deleteAll bool
+}
+
+func (op backingOp) apply(store IBackingStore) error {
+	switch {
+	case op.deleteAll:
+		return store.DeleteAll()
+	case op.delete:
+		return store.Delete(op.item.Key)
+	default:
+		return store.Set(op.item)
+	}
+}
+
+// Errors returned by `WriteBehindStore` when its queue is full or it was closed
+var (
+	ErrQueueFull   = errors.New("cache: write-behind queue is full")
+	ErrStoreClosed = errors.New("cache: write-behind store is closed")
+)
+
+// Queues writes and applies them to the wrapped store in batches (write-behind).
+// Writes are flushed by its own goroutine, so callers never wait for the wrapped store.
+// When the queue is full new writes are dropped. `Close` flushes the rest of the queue.
+type WriteBehindStore struct {
+	store     IBackingStore
+	queue     []backingOp
+	queueSize int64  // 0 for unlimited
+	retries   int    // how many times retry failed write
+	dropped   uint64 // writes which didn't fit into the queue
+	closed    bool
+	wake      chan struct{}
+	stop      chan struct{}
+	done      chan struct{} // closed when the flushing goroutine ends
+	flushing  sync.Mutex
+	sync.Mutex
+}
+
+func NewWriteBehindStore(store IBackingStore, flushFrequency int32, queueSize int64, retries int) *WriteBehindStore {
+	wb := &WriteBehindStore{
+		store:     store,
+		queueSize: queueSize,
+		retries:   retries,
+		wake:      make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go wb.run(flushFrequency)
+	return wb
+}
+
+// Flushes the queue every `flushFrequency` seconds (if it's set) and whenever it gets full.
+func (wb *WriteBehindStore) run(flushFrequency int32) {
+	defer close(wb.done)
+	var tick <-chan time.Time
+	if flushFrequency > 0 {
+		ticker := time.NewTicker(time.Duration(flushFrequency) * time.Second)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-wb.stop:
+			return
+		case <-tick:
+		case <-wb.wake:
+		}
+		if err := wb.Flush(); err != nil {
+			fmt.Println("Flushing of write-behind queue failed:", err)
+			// give the store a while, full queue would wake us up again right away
+			select {
+			case <-wb.stop:
+				return
+			case <-time.After(time.Second):
+			}
+		}
+	}
+}
+
+// Stops the flushing goroutine and flushes the rest of the queue. Next writes return `ErrStoreClosed`.
+func (wb *WriteBehindStore) Close() error {
+	wb.Lock()
+	if wb.closed {
+		wb.Unlock()
+		return nil
+	}
+	wb.closed = true
+	wb.Unlock()
+
+	close(wb.stop)
+	<-wb.done
+	return wb.Flush()
+}
+
+func (wb *WriteBehindStore) Set(item types.CacheItem) error {
+	return wb.enqueue(backingOp{item: item})
+}
+
+func (wb *WriteBehindStore) Delete(key string) error {
+	return wb.enqueue(backingOp{item: types.CacheItem{Key: key}, delete: true})
+}
+
+func (wb *WriteBehindStore) DeleteAll() error {
+	wb.Lock()
+	defer wb.Unlock()
+
+	if wb.closed {
+		return ErrStoreClosed
+	}
+	// queued writes would be deleted anyway
+	wb.queue = []backingOp{{deleteAll: true}}
+	return nil
+}
+
+func (wb *WriteBehindStore) enqueue(op backingOp) error {
+	wb.Lock()
+	defer wb.Unlock()
+
+	if wb.closed {
+		return ErrStoreClosed
+	}
+	if wb.isFull() {
+		wb.dropped++
+		wb.signal()
+		return ErrQueueFull
+	}
+	wb.queue = append(wb.queue, op)
+	if wb.isFull() {
+		wb.signal()
+	}
+	return nil
+}
+
+// Caller must hold the lock.
+func (wb *WriteBehindStore) isFull() bool {
+	return wb.queueSize > 0 && int64(len(wb.queue)) >= wb.queueSize
+}
+
+// Wakes up the flushing goroutine without waiting for it.
+func (wb *WriteBehindStore) signal() {
+	select {
+	case wb.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Number of writes waiting for flush
+func (wb *WriteBehindStore) Pending() int {
+	wb.Lock()
+	defer wb.Unlock()
+
+	return len(wb.queue)
+}
+
+// Number of writes dropped because the queue was full
+func (wb *WriteBehindStore) Dropped() uint64 {
+	wb.Lock()
+	defer wb.Unlock()
+
+	return wb.dropped
+}
+
+// Applies queued writes in order. Failed write is retried, if it still fails
+// it stays in the queue with all writes after it for the next flush.
+// Writes queued meanwhile which don't fit into the queue anymore are dropped.
+func (wb *WriteBehindStore) Flush() error {
+	wb.flushing.Lock()
+	defer wb.flushing.Unlock()
+
+	wb.Lock()
+	batch := wb.queue
+	wb.queue = nil
+	wb.Unlock()
+
+	for i, op := range batch {
+		err := op.apply(wb.store)
+		for attempt := 1; err != nil && attempt <= wb.retries; attempt++ {
+			time.Sleep(time.Duration(attempt) * 100 * time.Millisecond)
+			err = op.apply(wb.store)
+		}
+		if err != nil {
+			wb.Lock()
+			wb.queue = append(batch[i:], wb.queue...)
+			if wb.queueSize > 0 && int64(len(wb.queue)) > wb.queueSize {
+				wb.dropped += uint64(int64(len(wb.queue)) - wb.queueSize)
+				wb.queue = wb.queue[:wb.queueSize]
+			}
+			wb.Unlock()
+			return err
+		}
+	}
+	return nil
+}
+
+// Keeps every item in its own JSON file in the directory.
+type FileStore struct {
+	dir string
+	sync.RWMutex
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+const fileStoreExt = ".json"
+
+// Key is encoded so it can be used as a file name
+func (store *FileStore) path(key string) string {
+	return filepath.Join(store.dir, base64.RawURLEncoding.EncodeToString([]byte(key))+fileStoreExt)
+}
+
+func (store *FileStore) Set(item types.CacheItem) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+
+	store.Lock()
+	defer store.Unlock()
+
+	// write to temporary file first so readers never see half of the item
+	tmp := store.path(item.Key) + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, store.path(item.Key))
+}
+
+func (store *FileStore) Delete(key string) error {
+	store.Lock()
+	defer store.Unlock()
+
+	if err := os.Remove(store.path(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (store *FileStore) DeleteAll() error {
+	store.Lock()
+	defer store.Unlock()
+
+	files, err := ioutil.ReadDir(store.dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if strings.HasSuffix(file.Name(), fileStoreExt) {
+			if err := os.Remove(filepath.Join(store.dir, file.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Can be used as `Loader` of the cache
+func (store *FileStore) Load(key string) (types.CacheItem, error) {
+	store.RLock()
+	defer store.RUnlock()
+
+	item := types.CacheItem{}
+	data, err := ioutil.ReadFile(store.path(key))
+	if os.IsNotExist(err) {
+		return item, ErrNotFound
+	} else if err != nil {
+		return item, err
+	}
+	err = json.Unmarshal(data, &item)
+	return item, err
+}
+
+// Error returned by `MemoryStore` when failure is simulated
+var ErrStoreUnavailable = errors.New("cache: backing store unavailable")
+
+// Backing store in memory. Mainly for testing - `FailNext` simulates failures of the next operations.
+type MemoryStore struct {
+	Items    map[string]types.CacheItem
+	FailNext int
+	sync.Mutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{Items: make(map[string]types.CacheItem)}
+}
+
+func (store *MemoryStore) fail() bool {
+	if store.FailNext > 0 {
+		store.FailNext--
+		return true
+	}
+	return false
+}
+
+func (store *MemoryStore) Set(item types.CacheItem) error {
+	store.Lock()
+	defer store.Unlock()
+
+	if store.fail() {
+		return ErrStoreUnavailable
+	}
+	store.Items[item.Key] = item
+	return nil
+}
+
+func (store *MemoryStore) Delete(key string) error {
+	store.Lock()
+	defer store.Unlock()
+
+	if store.fail() {
+		return ErrStoreUnavailable
+	}
+	delete(store.Items, key)
+	return nil
+}
+
+func (store *MemoryStore) DeleteAll() error {
+	store.Lock()
+	defer store.Unlock()
+
+	if store.fail() {
+		return ErrStoreUnavailable
+	}
+	store.Items = make(map[string]types.CacheItem)
+	return nil
+}
+
+// Can be used as `Loader` of the cache
+func (store *MemoryStore) Load(key string) (types.CacheItem, error) {
+	store.Lock()
+	defer store.Unlock()
+
+	item, found := store.Items[key]
+	if !found {
+		return item, ErrNotFound
+	}
+	return item, nil
+}
@@ -0,0 +1,125 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	types "tohan.net/go-practice/src/cache/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_WriteThrough(t *testing.T) {
+	cache := prepareBrandNewCache()
+	store := NewMemoryStore()
+	cache.SetBackingStore(store)
+
+	cache.FillWithDefaultData()
+	assert.Equal(t, len(defaultTestKeyValues), len(store.Items), "all items should be written through")
+
+	cache.RemoveItem("one")
+	_, found := store.Items["one"]
+	assert.False(t, found, "removed item should be deleted from store")
+
+	cache.Incr("counter", 2)
+	assert.Equal(t, "2", store.Items["counter"].Value, "counter should be written through")
+
+	cache.RemoveAllItems()
+	assert.Empty(t, store.Items, "store should be flushed")
+}
+
+func TestWriteBehindStore(t *testing.T) {
+	store := NewMemoryStore()
+	wb := NewWriteBehindStore(store, 0, 0, 1)
+	cache := prepareBrandNewCache()
+	cache.SetBackingStore(wb)
+
+	cache.FillWithDefaultData()
+	cache.RemoveItem("one")
+	assert.Empty(t, store.Items, "writes should wait for flush")
+	assert.Equal(t, len(defaultTestKeyValues)+1, wb.Pending(), "all writes should be queued")
+
+	assert.Nil(t, wb.Flush(), "flush should succeed")
+	assert.Equal(t, len(defaultTestKeyValues)-1, len(store.Items), "writes should be applied in order")
+	assert.Equal(t, 0, wb.Pending(), "queue should be empty")
+
+	// first attempt and one retry fail
+	store.FailNext = 2
+	cache.AddItem(types.CacheItem{Key: "new", Value: "1"})
+	assert.NotNil(t, wb.Flush(), "flush should fail")
+	assert.Equal(t, 1, wb.Pending(), "failed write should stay in queue")
+	assert.Nil(t, wb.Flush(), "flush should succeed")
+	assert.Equal(t, "1", store.Items["new"].Value, "failed write should be applied later")
+}
+
+func TestWriteBehindStore_QueueSize(t *testing.T) {
+	store := NewMemoryStore()
+	wb := NewWriteBehindStore(store, 0, 2, 0)
+
+	wb.Set(types.CacheItem{Key: "1"})
+	assert.Equal(t, 1, wb.Pending(), "write should be queued")
+	wb.Set(types.CacheItem{Key: "2"})
+	assert.Eventually(t, func() bool {
+		store.Lock()
+		defer store.Unlock()
+		return len(store.Items) == 2
+	}, time.Second, 10*time.Millisecond, "full queue should be flushed by its goroutine")
+}
+
+func TestWriteBehindStore_Close(t *testing.T) {
+	store := NewMemoryStore()
+	wb := NewWriteBehindStore(store, 3600, 100, 0)
+
+	wb.Set(types.CacheItem{Key: "1"})
+	wb.Delete("2")
+	assert.Nil(t, wb.Close(), "store should be closed")
+	assert.Equal(t, 0, wb.Pending(), "queue should be flushed on close")
+	_, found := store.Items["1"]
+	assert.True(t, found, "queued write should be applied on close")
+	assert.Equal(t, ErrStoreClosed, wb.Set(types.CacheItem{Key: "3"}), "write after close should be rejected")
+	assert.Nil(t, wb.Close(), "second close should do nothing")
+}
+
+func TestWriteBehindStore_FailingStore(t *testing.T) {
+	store := NewMemoryStore()
+	store.FailNext = 1000
+	wb := NewWriteBehindStore(store, 0, 2, 3)
+	cache := prepareBrandNewCache()
+	cache.SetBackingStore(wb)
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		cache.AddItem(types.CacheItem{Key: strconv.Itoa(i), Value: "1"})
+	}
+	assert.True(t, time.Since(start) < 50*time.Millisecond, "writes shouldnt wait for the store")
+	assert.True(t, wb.Pending() <= 2, "queue size should be kept")
+
+	// failed batch is put back, writes which don't fit anymore are dropped
+	assert.Eventually(t, func() bool { return wb.Dropped() == 3 && wb.Pending() == 2 }, 2*time.Second, 10*time.Millisecond, "writes over queue size should be dropped")
+	assert.Equal(t, ErrQueueFull, wb.Set(types.CacheItem{Key: "more"}), "full queue should be reported")
+}
+
+func TestFileStore(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "filestore")
+	defer os.RemoveAll(dir)
+	store, err := NewFileStore(dir)
+	assert.Nil(t, err, "store should be created")
+
+	item := types.CacheItem{Key: "BTC:1/2", Value: "tomas", TTL: 5}
+	assert.Nil(t, store.Set(item), "item should be saved")
+	loaded, err := store.Load("BTC:1/2")
+	assert.Nil(t, err, "item should be loaded")
+	assert.Equal(t, item, loaded, "loaded item not matching")
+
+	assert.Nil(t, store.Delete("BTC:1/2"), "item should be deleted")
+	_, err = store.Load("BTC:1/2")
+	assert.Equal(t, ErrNotFound, err, "deleted item shouldnt be found")
+
+	store.Set(item)
+	assert.Nil(t, store.DeleteAll(), "all items should be deleted")
+	files, _ := ioutil.ReadDir(dir)
+	assert.Empty(t, files, "directory should be empty")
+}
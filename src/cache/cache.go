@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"sync"
@@ -9,20 +10,52 @@ import (
 	types "tohan.net/go-practice/src/cache/types"
 )
 
+var (
+	ErrPreconditionFailed = errors.New("cache: precondition failed")
+	ErrNotStored          = errors.New("cache: item rejected by admission policy or bigger than MaxBytes")
+	ErrInvalidTTL         = errors.New("cache: TTL has to be positive, 0 for default or -1 for no expiration")
+)
+
 // Use RWMutex instead of Mutex for better performance
 // with read ops and for safe concurency with `map`
 type Cache struct {
 	Config        types.CacheConfig
 	Store         map[string]types.CacheItemWrapper
 	InputAdapters []IAdapter
+	eviction      IEvictionPolicy
+	admission     IAdmissionPolicy // nil admits everything
+	expirations   *expirationIndex
+	keys          *keyIndex // sorted keys for scanning
+	version       uint64    // last version given to an item
+	backingStore  IBackingStore
+	wal           *writeAheadLog
+	loader        Loader
+	loads         loadGroup
+	negatives     *expirationIndex // keys confirmed absent by loader
+	watchers      map[*Watcher]struct{}
+	eventID       uint64 // last ID given to an event
+	history       eventHistory
+	onEvict       []RemovalHook
+	onExpire      []RemovalHook
+	onDelete      []RemovalHook
+	sizer         Sizer
+	usedBytes     int64 // size of all items counted by sizer
+	txAdmitted    bool  // writes of the running transaction were admitted before
+	stats         types.CacheStats
+	reads         readBuffer // accesses of reads under the read lock
 	m             sync.RWMutex
 }
 
 func NewCache(config types.CacheConfig) *Cache {
 	cacheItems := make(map[string]types.CacheItemWrapper, 0)
 	cache := &Cache{
-		Store:  cacheItems,
-		Config: config,
+		Store:       cacheItems,
+		Config:      config,
+		eviction:    NewEvictionPolicy(config.EvictionPolicy),
+		admission:   NewAdmissionPolicy(config.AdmissionPolicy, config.Capacity),
+		expirations: newExpirationIndex(),
+		keys:        newKeyIndex(),
+		negatives:   newExpirationIndex(),
 	}
 
 	// Collect data from adapters.
@@ -63,38 +96,319 @@ func (cache *Cache) AddItem(item types.CacheItem) {
 	cache.m.Lock()
 	defer cache.m.Unlock()
 
-	newWrappedItem := types.CacheItemWrapper{
+	cache.set(item)
+}
+
+// Add item with its own TTL. Use `types.NoExpiration` for item that never expires.
+func (cache *Cache) AddItemWithTTL(item types.CacheItem, ttl int32) error {
+	item.TTL = ttl
+	if !item.HasValidTTL() {
+		return ErrInvalidTTL
+	}
+	cache.AddItem(item)
+	return nil
+}
+
+// Same as `AddItem` but returns new version of the item.
+// `ErrNotStored` if the item was rejected by admission policy or it's bigger than `MaxBytes`.
+func (cache *Cache) Upsert(item types.CacheItem) (uint64, error) {
+	cache.m.Lock()
+	defer cache.m.Unlock()
+
+	return cache.setVersion(item)
+}
+
+// Update the item only if its version didn't change since it was read.
+// Returns new version of the item, `ErrPreconditionFailed` if the version changed.
+func (cache *Cache) CompareAndSwap(key string, expectedVersion uint64, item types.CacheItem) (uint64, error) {
+	cache.m.Lock()
+	defer cache.m.Unlock()
+
+	current, found := cache.lookup(key)
+	if !found || current.Version != expectedVersion {
+		return 0, ErrPreconditionFailed
+	}
+	item.Key = key
+	return cache.setVersion(item)
+}
+
+// Add the item only if there is no living item with the same key.
+func (cache *Cache) AddIfAbsent(item types.CacheItem) (uint64, error) {
+	cache.m.Lock()
+	defer cache.m.Unlock()
+
+	if _, found := cache.lookup(item.Key); found {
+		return 0, ErrPreconditionFailed
+	}
+	return cache.setVersion(item)
+}
+
+// Update the item only if there is living item with the same key.
+func (cache *Cache) ReplaceIfPresent(item types.CacheItem) (uint64, error) {
+	cache.m.Lock()
+	defer cache.m.Unlock()
+
+	if _, found := cache.lookup(item.Key); !found {
+		return 0, ErrPreconditionFailed
+	}
+	return cache.setVersion(item)
+}
+
+// Caller must hold the write lock.
+func (cache *Cache) setVersion(item types.CacheItem) (uint64, error) {
+	wrappedItem, stored := cache.set(item)
+	if !stored {
+		return 0, ErrNotStored
+	}
+	return wrappedItem.Version, nil
+}
+
+// Inserts item and persists it. Returns false if the item was not stored,
+// it's not persisted then. Caller must hold the write lock.
+func (cache *Cache) set(item types.CacheItem) (types.CacheItemWrapper, bool) {
+	wrappedItem, stored := cache.add(item)
+	if stored {
+		cache.persistSet(wrappedItem)
+	}
+	return wrappedItem, stored
+}
+
+// Propagates writes to the log and backing store.
+// Caller must hold the write lock, so they get writes in the same order as the cache.
+func (cache *Cache) persistSet(wrappedItem types.CacheItemWrapper) {
+	cache.logSet(wrappedItem)
+	cache.writeThrough(wrappedItem.CacheItem)
+}
+
+// Logs new expiration or value of the item, so it survives replay. Caller must hold the write lock.
+func (cache *Cache) logSet(wrappedItem types.CacheItemWrapper) {
+	record := wrappedItem.ToRecord()
+	cache.appendWAL(walRecord{Op: walOpSet, Record: &record})
+}
+
+func (cache *Cache) persistDelete(key string) {
+	cache.appendWAL(walRecord{Op: walOpDelete, Key: key})
+	cache.deleteThrough(key)
+}
+
+func (cache *Cache) persistDeleteAll() {
+	cache.appendWAL(walRecord{Op: walOpDeleteAll})
+	cache.deleteAllThrough()
+}
+
+// Inserts item and makes a space for it if necessary. Returns false if the item was not stored.
+// Caller must hold the write lock.
+func (cache *Cache) add(item types.CacheItem) (types.CacheItemWrapper, bool) {
+	// eviction has to know about all reads and access metadata of the previous item are kept
+	cache.drainReads()
+	previous, exists := cache.Store[item.Key]
+
+	if item.TTL == 0 {
+		item.TTL = cache.Config.TTL
+	}
+	item.Sliding = item.Sliding || cache.Config.SlidingExpiration
+
+	now := time.Now().Unix()
+	wrappedItem := types.CacheItemWrapper{
 		CacheItem:    item,
-		ExpirationAt: time.Now().Unix() + int64(cache.Config.TTL),
+		ExpirationAt: expirationAt(item.TTL),
+		CreatedAt:    now,
+		UpdatedAt:    now,
+		Version:      cache.version + 1, // taken only if the item is stored
+	}
+	if exists {
+		wrappedItem.CreatedAt = previous.CreatedAt
+		wrappedItem.AccessedAt = previous.AccessedAt
+		wrappedItem.AccessCount = previous.AccessCount
+	}
+
+	if !cache.put(wrappedItem) {
+		return wrappedItem, false
+	}
+	cache.version = wrappedItem.Version
+	if exists {
+		cache.notifySet(&previous, wrappedItem)
+	} else {
+		cache.notifySet(nil, wrappedItem)
 	}
-	cache.Store[item.Key] = newWrappedItem
+	return wrappedItem, true
+}
+
+// Saves wrapped item and makes a space for it if necessary. Returns false if it was rejected
+// by admission policy or it doesn't fit into `MaxBytes` at all. Caller must hold the write lock.
+func (cache *Cache) put(wrappedItem types.CacheItemWrapper) bool {
+	key := wrappedItem.Key
+	cache.negatives.Remove(key)
+	if !cache.admit(wrappedItem.CacheItem) {
+		return false
+	}
+	if !cache.makeSpaceFor(wrappedItem.CacheItem) {
+		return false
+	}
+	_, exists := cache.Store[key]
 
-	// remove oldest if cache overflow... can happen just once ...
-	if cache.Config.Capacity > 0 && cache.Size() > cache.Config.Capacity {
-		oldestKey, oldestTimestamp := newWrappedItem.Key, newWrappedItem.ExpirationAt
-		for key, wrappedItem := range cache.Store {
-			if wrappedItem.ExpirationAt <= oldestTimestamp {
-				oldestKey, oldestTimestamp = key, wrappedItem.ExpirationAt
+	// make a space for a new item... existing ones are just replaced
+	if !exists && cache.Config.Capacity > 0 {
+		for cache.Size() >= cache.Config.Capacity {
+			victim, found := cache.eviction.Victim()
+			if !found {
+				break
 			}
+			cache.removeBecause(victim, RemovalEvicted)
 		}
-		delete(cache.Store, oldestKey)
 	}
+
+	cache.setWrapped(wrappedItem)
+	if exists {
+		cache.eviction.Access(key)
+	} else {
+		cache.eviction.Add(key)
+	}
+	return true
 }
 
+// Returns expiration timestamp for the TTL from now. 0 if item never expires.
+func expirationAt(ttl int32) int64 {
+	if ttl == types.NoExpiration {
+		return 0
+	}
+	return time.Now().Unix() + int64(ttl)
+}
+
+// Saves wrapped item and indexes its key and expiration. Caller must hold the write lock.
+func (cache *Cache) setWrapped(wrappedItem types.CacheItemWrapper) {
+	if previous, exists := cache.Store[wrappedItem.Key]; exists {
+		cache.usedBytes -= cache.sizeOf(previous.CacheItem)
+	} else {
+		cache.keys.Add(wrappedItem.Key)
+	}
+	cache.usedBytes += cache.sizeOf(wrappedItem.CacheItem)
+	cache.Store[wrappedItem.Key] = wrappedItem
+	cache.expirations.Set(wrappedItem.Key, wrappedItem.ExpirationAt)
+}
+
+// Caller must hold the write lock.
+func (cache *Cache) remove(key string) {
+	if previous, exists := cache.Store[key]; exists {
+		cache.usedBytes -= cache.sizeOf(previous.CacheItem)
+	}
+	delete(cache.Store, key)
+	cache.keys.Remove(key)
+	cache.eviction.Remove(key)
+	cache.expirations.Remove(key)
+}
+
+// Missing item is loaded by the loader if it is set.
 func (cache *Cache) GetItem(key string) (types.CacheItem, bool) {
-	cache.m.RLock()
-	wrappedItem, found := cache.Store[key]
-	cache.m.RUnlock()
+	// living items are read just under the read lock
+	if wrappedItem, found := cache.getShared(key); found {
+		return wrappedItem.ToCacheItem(), true
+	}
+	wrappedItem, found := cache.getOrLoad(key)
+	return wrappedItem.ToCacheItem(), found
+}
+
+// Same as `GetItem` but with metadata of the item. Access time and count
+// don't contain other reads which are still in the read buffer.
+func (cache *Cache) GetItemWithMeta(key string) (types.CacheItem, types.ItemMeta, bool) {
+	if wrappedItem, found := cache.getShared(key); found {
+		return wrappedItem.ToCacheItem(), wrappedItem.Meta(), true
+	}
+	wrappedItem, found := cache.getOrLoad(key)
+	return wrappedItem.ToCacheItem(), wrappedItem.Meta(), found
+}
+
+func (cache *Cache) getOrLoad(key string) (types.CacheItemWrapper, bool) {
+	// write lock because the read can remove expired item or prolong sliding one
+	cache.m.Lock()
+	cache.drainReads()
+	if cache.admission != nil {
+		cache.admission.Record(key)
+	}
+	wrappedItem, found := cache.get(key)
+	loader := cache.loader
+	isNegative := !found && cache.isNegative(key)
+	cache.countRead(found, isNegative)
+	cache.m.Unlock()
 
 	if found && wrappedItem.IsExpired() {
-		cache.m.Lock()
-		defer cache.m.Unlock()
+		// serve stale item and refresh it in background, just once at a time
+		if cache.loads.startRefresh(key) {
+			go cache.refresh(key, loader, wrappedItem.Version)
+		}
+		return wrappedItem, true
+	}
+	if found || isNegative || loader == nil {
+		return wrappedItem, found
+	}
+	return cache.load(key, loader, 0)
+}
 
-		delete(cache.Store, key)
-		return types.CacheItem{}, false
+// Expired item can be still served during grace period while it is refreshed by the loader.
+// Caller must hold the lock.
+func (cache *Cache) isServableStale(wrappedItem *types.CacheItemWrapper) bool {
+	return cache.loader != nil && cache.Config.StaleGracePeriod > 0 && wrappedItem.ExpirationAt != 0 &&
+		time.Now().Unix() < wrappedItem.ExpirationAt+int64(cache.Config.StaleGracePeriod)
+}
+
+// Returns living item without recording the access. Expired one is removed
+// unless it can be still served as stale. Caller must hold the write lock.
+func (cache *Cache) lookup(key string) (types.CacheItemWrapper, bool) {
+	wrappedItem, found := cache.Store[key]
+	if !found {
+		return types.CacheItemWrapper{}, false
 	}
+	if wrappedItem.IsExpired() {
+		if !cache.isServableStale(&wrappedItem) {
+			cache.removeBecause(key, RemovalExpired)
+		}
+		return types.CacheItemWrapper{}, false
+	}
+	return wrappedItem, true
+}
 
-	return wrappedItem.ToCacheItem(), found
+// Returns living or servable stale item and records the access. Caller must hold the write lock.
+func (cache *Cache) get(key string) (types.CacheItemWrapper, bool) {
+	wrappedItem, found := cache.Store[key]
+	if !found {
+		return types.CacheItemWrapper{}, false
+	}
+	isExpired := wrappedItem.IsExpired()
+	if isExpired && !cache.isServableStale(&wrappedItem) {
+		cache.removeBecause(key, RemovalExpired)
+		return types.CacheItemWrapper{}, false
+	}
+	cache.eviction.Access(key)
+
+	wrappedItem.AccessedAt = time.Now().Unix()
+	wrappedItem.AccessCount++
+	isSliding := wrappedItem.Sliding && !isExpired
+	if isSliding {
+		wrappedItem.ExpirationAt = expirationAt(wrappedItem.TTL)
+	}
+	cache.setWrapped(wrappedItem)
+	if isSliding {
+		cache.logSet(wrappedItem)
+	}
+
+	return wrappedItem, true
+}
+
+// Prolong expiration of the item by its TTL. Returns false if there is no such item.
+func (cache *Cache) Touch(key string) bool {
+	cache.m.Lock()
+	defer cache.m.Unlock()
+
+	wrappedItem, found := cache.lookup(key)
+	if !found {
+		return false
+	}
+	wrappedItem.ExpirationAt = expirationAt(wrappedItem.TTL)
+	cache.setWrapped(wrappedItem)
+	cache.eviction.Access(key)
+	cache.logSet(wrappedItem)
+
+	return true
 }
 
 func (cache *Cache) GetAllItems() *[]types.CacheItem {
@@ -113,7 +427,8 @@ func (cache *Cache) RemoveItem(key string) {
 	cache.m.Lock()
 	defer cache.m.Unlock()
 
-	delete(cache.Store, key)
+	cache.removeBecause(key, RemovalDeleted)
+	cache.persistDelete(key)
 }
 
 func (cache *Cache) RemoveAllItems() {
@@ -121,21 +436,40 @@ func (cache *Cache) RemoveAllItems() {
 	defer cache.m.Unlock()
 
 	for key := range cache.Store {
-		delete(cache.Store, key)
+		cache.removeBecause(key, RemovalFlushed)
 	}
+	cache.negatives = newExpirationIndex()
+	cache.persistDeleteAll()
 }
 
+// Removes expired items in batches so readers are not blocked for too long.
 func (cache *Cache) RemoveExpiredItems() {
-	cache.m.Lock()
-	defer cache.m.Unlock()
+	batchSize := int(cache.Config.ExpBatchSize)
+	if batchSize <= 0 {
+		batchSize = DefaultExpBatchSize
+	}
 
-	for key, wrappedItem := range cache.Store {
-		if wrappedItem.IsExpired() {
-			delete(cache.Store, key)
+	for {
+		cache.m.Lock()
+		// stale items are kept during grace period if they can be refreshed
+		expiredAt := time.Now().Unix()
+		if cache.loader != nil {
+			expiredAt -= int64(cache.Config.StaleGracePeriod)
+		}
+		keys := cache.expirations.PopExpired(expiredAt, batchSize)
+		for _, key := range keys {
+			cache.removeBecause(key, RemovalExpired)
+		}
+		negativeKeys := cache.negatives.PopExpired(time.Now().Unix(), batchSize)
+		cache.m.Unlock()
+
+		if len(keys) < batchSize && len(negativeKeys) < batchSize {
+			return
 		}
 	}
 }
 
+// Writes items into the file as `KEY:VALUE` lines. Use `Export` for other formats.
 func (cache *Cache) Dump(filename string) {
 	file, err := os.Create(filename)
 
@@ -144,9 +478,7 @@ func (cache *Cache) Dump(filename string) {
 	}
 	defer file.Close()
 
-	cache.m.Lock()
-	defer cache.m.Unlock()
-	for _, item := range cache.Store {
-		file.WriteString(fmt.Sprintf("%s:%s\n", item.Key, item.Value))
+	if err := cache.Export(file, ExportKeyValue, false); err != nil {
+		panic(err)
 	}
 }
@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"bufio"
 	"fmt"
 	"strings"
 	"testing"
@@ -33,13 +34,13 @@ func (cache *MockCache) FillWithDefaultData() {
 // Helper function to fill cache with expired data.
 func (cache *MockCache) FillWithDefaultDataAsExpired() {
 	for key, value := range defaultTestKeyValues {
-		cache.Store[key] = types.CacheItemWrapper{
+		cache.setWrapped(types.CacheItemWrapper{
 			CacheItem: types.CacheItem{
 				Key:   key,
 				Value: value,
 			},
 			ExpirationAt: 1,
-		}
+		})
 	}
 }
 
@@ -149,7 +150,7 @@ func TestCache_RandomInputAdapter(t *testing.T) {
 	cache := prepareBrandNewCache()
 
 	// set data generation frequency to 0 so we can do it manualy
-	cache.SetInputAdapter(NewRandomInputAdapter(0, 10, 0))
+	cache.SetInputAdapter(NewRandomInputAdapter(0, 10, 0, 0))
 
 	// generate data manualy
 	cache.InputAdapters[0].(*RandomInputAdapter).generateData()
@@ -183,3 +184,110 @@ func TestCache_CommandLineInputAdapter(t *testing.T) {
 	assert.Equal(t, int64(3), cache.Size(), "cache size not matching")
 	assert.True(t, cache.InputAdapters[0].(*CommandLineInputAdapter).queue.IsEmpty(), "adapter's queue should be empty")
 }
+
+func TestCache_AddItemWithTTL(t *testing.T) {
+	cache := prepareBrandNewCache()
+
+	cache.AddItemWithTTL(types.CacheItem{Key: "forever", Value: "1"}, types.NoExpiration)
+	cache.AddItemWithTTL(types.CacheItem{Key: "short", Value: "2"}, 5)
+	cache.AddItem(types.CacheItem{Key: "default", Value: "3"})
+
+	assert.Equal(t, int64(0), cache.Store["forever"].ExpirationAt, "item without expiration shouldnt have expiration time")
+	forever := cache.Store["forever"]
+	assert.False(t, forever.IsExpired(), "item without expiration shouldnt expire")
+	assert.Equal(t, int32(5), cache.Store["short"].TTL, "item should keep its own TTL")
+	assert.Equal(t, cache.Config.TTL, cache.Store["default"].TTL, "item should get default TTL")
+
+	item, _ := cache.GetItem("short")
+	assert.Equal(t, int32(5), item.TTL, "returned item should contain its TTL")
+
+	err := cache.AddItemWithTTL(types.CacheItem{Key: "invalid", Value: "4"}, -5)
+	assert.Equal(t, ErrInvalidTTL, err, "TTL below NoExpiration should be rejected")
+	_, found := cache.Store["invalid"]
+	assert.False(t, found, "item with invalid TTL shouldnt be stored")
+}
+
+func TestCache_CommandLineInputAdapterWithTTL(t *testing.T) {
+	testString := "test1:test1:5\ntest2:test2:-1\ntest3:test3:abc\nSTOP\n"
+	// without constructor so it is not read by another goroutine
+	adapter := &CommandLineInputAdapter{reader: bufio.NewReader(strings.NewReader(testString))}
+	adapter.readFromStdin()
+
+	items := adapter.GetData()
+	assert.Equal(t, 2, len(items), "item with wrong TTL should be skipped")
+	assert.Equal(t, int32(5), items[0].TTL, "TTL should be parsed")
+	assert.Equal(t, types.NoExpiration, items[1].TTL, "TTL should be parsed")
+}
+
+func TestCache_SlidingExpiration(t *testing.T) {
+	cache := prepareBrandNewCache()
+	cache.AddItem(types.CacheItem{Key: "sliding", Value: "1", TTL: 10, Sliding: true})
+	cache.AddItem(types.CacheItem{Key: "fixed", Value: "2", TTL: 10})
+
+	// pretend items were written long time ago
+	for _, key := range []string{"sliding", "fixed"} {
+		wrappedItem := cache.Store[key]
+		wrappedItem.ExpirationAt -= 5
+		cache.setWrapped(wrappedItem)
+	}
+	slidingExpiration, fixedExpiration := cache.Store["sliding"].ExpirationAt, cache.Store["fixed"].ExpirationAt
+
+	cache.GetItem("sliding")
+	cache.GetItem("fixed")
+	assert.True(t, cache.Store["sliding"].ExpirationAt > slidingExpiration, "reading should prolong sliding item")
+	assert.Equal(t, fixedExpiration, cache.Store["fixed"].ExpirationAt, "reading shouldnt prolong fixed item")
+
+	assert.True(t, cache.Touch("fixed"), "known item should be touched")
+	assert.True(t, cache.Store["fixed"].ExpirationAt > fixedExpiration, "touch should prolong item")
+	assert.False(t, cache.Touch("UNKNOWN_KEY"), "unknown item shouldnt be touched")
+}
+
+func TestCache_GetItemWithMeta(t *testing.T) {
+	cache := prepareBrandNewCache()
+	cache.AddItem(types.CacheItem{Key: "one", Value: "1"})
+	_, meta, found := cache.GetItemWithMeta("one")
+	assert.True(t, found, "In case of known item should return true.")
+	assert.Equal(t, int64(1), meta.AccessCount, "access should be counted")
+	assert.NotEmpty(t, meta.CreatedAt, "creation time should be set")
+	assert.NotEmpty(t, meta.AccessedAt, "access time should be set")
+	firstVersion := meta.Version
+
+	cache.AddItem(types.CacheItem{Key: "other", Value: "2"})
+	cache.AddItem(types.CacheItem{Key: "one", Value: "3"})
+	cache.GetItem("one")
+	cache.AddItem(types.CacheItem{Key: "other", Value: "4"}) // applies buffered reads
+	_, meta, _ = cache.GetItemWithMeta("one")
+	assert.Equal(t, int64(3), meta.AccessCount, "access count should survive update")
+	assert.Equal(t, firstVersion+2, meta.Version, "version should grow with every write in cache")
+
+	_, meta, found = cache.GetItemWithMeta("UKNOWN_KEY")
+	assert.False(t, found, "In case of unknown item should return false.")
+	assert.Empty(t, meta, "In case of unknown item meta should be empty.")
+}
+
+func TestCache_ConditionalWrites(t *testing.T) {
+	cache := prepareBrandNewCache()
+
+	version, err := cache.AddIfAbsent(types.CacheItem{Key: "one", Value: "1"})
+	assert.Nil(t, err, "missing item should be added")
+	_, err = cache.AddIfAbsent(types.CacheItem{Key: "one", Value: "2"})
+	assert.Equal(t, ErrPreconditionFailed, err, "existing item shouldnt be overwritten")
+
+	newVersion, err := cache.CompareAndSwap("one", version, types.CacheItem{Value: "3"})
+	assert.Nil(t, err, "item with expected version should be swapped")
+	assert.True(t, newVersion > version, "version should grow")
+	_, err = cache.CompareAndSwap("one", version, types.CacheItem{Value: "4"})
+	assert.Equal(t, ErrPreconditionFailed, err, "item with old version shouldnt be swapped")
+	item, _ := cache.GetItem("one")
+	assert.Equal(t, "3", item.Value, "only first swap should be applied")
+
+	_, err = cache.ReplaceIfPresent(types.CacheItem{Key: "two", Value: "1"})
+	assert.Equal(t, ErrPreconditionFailed, err, "missing item shouldnt be replaced")
+	_, err = cache.ReplaceIfPresent(types.CacheItem{Key: "one", Value: "5"})
+	assert.Nil(t, err, "existing item should be replaced")
+
+	// expired item is the same as missing one
+	cache.FillWithDefaultDataAsExpired()
+	_, err = cache.AddIfAbsent(types.CacheItem{Key: "two", Value: "1"})
+	assert.Nil(t, err, "expired item should be overwritten")
+}
@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	types "tohan.net/go-practice/src/cache/types"
+)
+
+var (
+	ErrNotNumeric = errors.New("cache: value is not an integer")
+	ErrOverflow   = errors.New("cache: increment would overflow")
+)
+
+// Atomically adds delta to the integer value of the item and returns the new value.
+// Missing item is created with default TTL. Expiration of existing item is kept.
+// Returns `ErrNotStored` if the new value would be rejected by admission policy or `MaxBytes`.
+func (cache *Cache) Incr(key string, delta int64) (int64, error) {
+	cache.m.Lock()
+	defer cache.m.Unlock()
+
+	wrappedItem, found := cache.lookup(key)
+	if !found {
+		if _, stored := cache.set(types.CacheItem{Key: key, Value: strconv.FormatInt(delta, 10)}); !stored {
+			return 0, ErrNotStored
+		}
+		return delta, nil
+	}
+
+	if wrappedItem.HasPayload() {
+		return 0, ErrNotNumeric
+	}
+	value, err := strconv.ParseInt(wrappedItem.Value, 10, 64)
+	if err != nil {
+		return 0, ErrNotNumeric
+	}
+	if (delta > 0 && value > math.MaxInt64-delta) || (delta < 0 && value < math.MinInt64-delta) {
+		return 0, ErrOverflow
+	}
+	value += delta
+
+	// longer value can need a space too, so it goes through admission and eviction like other writes
+	cache.drainReads()
+	previous := wrappedItem
+	wrappedItem.Value = strconv.FormatInt(value, 10)
+	wrappedItem.UpdatedAt = time.Now().Unix()
+	wrappedItem.Version = cache.version + 1
+	if !cache.put(wrappedItem) {
+		return 0, ErrNotStored
+	}
+	cache.version = wrappedItem.Version
+	cache.persistSet(wrappedItem)
+	cache.notifySet(&previous, wrappedItem)
+
+	return value, nil
+}
+
+// Same as `Incr` with negative delta
+func (cache *Cache) Decr(key string, delta int64) (int64, error) {
+	if delta == math.MinInt64 {
+		return 0, ErrOverflow
+	}
+	return cache.Incr(key, -delta)
+}
@@ -0,0 +1,48 @@
+package cache
+
+import (
+	"testing"
+
+	types "tohan.net/go-practice/src/cache/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_Incr(t *testing.T) {
+	cache := prepareBrandNewCache()
+
+	value, err := cache.Incr("counter", 5)
+	assert.Nil(t, err, "missing counter should be created")
+	assert.Equal(t, int64(5), value, "missing counter should start at delta")
+
+	cache.Incr("counter", 2)
+	value, err = cache.Decr("counter", 10)
+	assert.Nil(t, err, "counter should be decremented")
+	assert.Equal(t, int64(-3), value, "counter value not matching")
+
+	item, _ := cache.GetItem("counter")
+	assert.Equal(t, "-3", item.Value, "counter should be saved as string")
+
+	cache.AddItem(types.CacheItem{Key: "text", Value: "tomas"})
+	_, err = cache.Incr("text", 1)
+	assert.Equal(t, ErrNotNumeric, err, "non-numeric value shouldnt be incremented")
+
+	cache.AddItem(types.CacheItem{Key: "max", Value: "9223372036854775807"})
+	_, err = cache.Incr("max", 1)
+	assert.Equal(t, ErrOverflow, err, "overflow should be detected")
+}
+
+func TestCache_IncrKeepsMaxBytes(t *testing.T) {
+	cache := prepareBrandNewCache()
+	cache.Config.MaxBytes = 10
+	cache.AddItem(types.CacheItem{Key: "a", Value: "xxxx"})
+	cache.Incr("c", 9)
+	assert.Equal(t, int64(7), cache.UsedBytes(), "both items should fit into limit")
+
+	value, err := cache.Incr("c", 99990)
+	assert.Nil(t, err, "longer counter should be stored")
+	assert.Equal(t, int64(99999), value, "counter value not matching")
+	assert.True(t, cache.UsedBytes() <= 10, "limit should be kept when counter grows")
+	_, found := cache.Store["a"]
+	assert.False(t, found, "other item should be evicted to make a space for the counter")
+}
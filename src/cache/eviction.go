@@ -0,0 +1,216 @@
+package cache
+
+import (
+	"container/list"
+	"math/rand"
+
+	types "tohan.net/go-practice/src/cache/types"
+)
+
+// Decides which key should be removed when the cache is full.
+// Policies are not safe for concurrent use - cache calls them under its own lock.
+type IEvictionPolicy interface {
+	Add(key string)         // key was inserted into the cache
+	Access(key string)      // key was read or updated
+	Remove(key string)      // key was removed from the cache
+	Victim() (string, bool) // key that should be evicted next
+}
+
+// Returns policy by its name from config. LRU is used by default.
+func NewEvictionPolicy(name string) IEvictionPolicy {
+	switch name {
+	case types.EvictionLFU:
+		return newLFUPolicy()
+	case types.EvictionFIFO:
+		return newFIFOPolicy()
+	case types.EvictionRandom:
+		return newRandomPolicy()
+	default:
+		return newLRUPolicy()
+	}
+}
+
+// Least recently used. Most recent keys are at the back of the list.
+type lruPolicy struct {
+	order *list.List
+	keys  map[string]*list.Element
+}
+
+func newLRUPolicy() *lruPolicy {
+	return &lruPolicy{order: list.New(), keys: make(map[string]*list.Element)}
+}
+
+func (p *lruPolicy) Add(key string) {
+	if el, found := p.keys[key]; found {
+		p.order.MoveToBack(el)
+		return
+	}
+	p.keys[key] = p.order.PushBack(key)
+}
+
+func (p *lruPolicy) Access(key string) {
+	if el, found := p.keys[key]; found {
+		p.order.MoveToBack(el)
+	}
+}
+
+func (p *lruPolicy) Remove(key string) {
+	if el, found := p.keys[key]; found {
+		p.order.Remove(el)
+		delete(p.keys, key)
+	}
+}
+
+func (p *lruPolicy) Victim() (string, bool) {
+	el := p.order.Front()
+	if el == nil {
+		return "", false
+	}
+	return el.Value.(string), true
+}
+
+// First in first out. Access doesn't change the order.
+type fifoPolicy struct {
+	lruPolicy
+}
+
+func newFIFOPolicy() *fifoPolicy {
+	return &fifoPolicy{lruPolicy: *newLRUPolicy()}
+}
+
+func (p *fifoPolicy) Add(key string) {
+	if _, found := p.keys[key]; !found {
+		p.keys[key] = p.order.PushBack(key)
+	}
+}
+
+func (p *fifoPolicy) Access(key string) {}
+
+// Least frequently used. Keys are grouped into lists by their frequency,
+// ties are resolved by LRU inside the least frequent list.
+type lfuEntry struct {
+	key  string
+	freq int64
+}
+
+type lfuPolicy struct {
+	keys    map[string]*list.Element
+	freqs   map[int64]*list.List
+	minFreq int64
+}
+
+func newLFUPolicy() *lfuPolicy {
+	return &lfuPolicy{keys: make(map[string]*list.Element), freqs: make(map[int64]*list.List)}
+}
+
+func (p *lfuPolicy) push(entry *lfuEntry) *list.Element {
+	l, found := p.freqs[entry.freq]
+	if !found {
+		l = list.New()
+		p.freqs[entry.freq] = l
+	}
+	return l.PushBack(entry)
+}
+
+func (p *lfuPolicy) unlink(el *list.Element) *lfuEntry {
+	entry := el.Value.(*lfuEntry)
+	l := p.freqs[entry.freq]
+	l.Remove(el)
+	if l.Len() == 0 {
+		delete(p.freqs, entry.freq)
+	}
+	return entry
+}
+
+func (p *lfuPolicy) Add(key string) {
+	if _, found := p.keys[key]; found {
+		p.Access(key)
+		return
+	}
+	p.keys[key] = p.push(&lfuEntry{key: key, freq: 1})
+	p.minFreq = 1
+}
+
+func (p *lfuPolicy) Access(key string) {
+	el, found := p.keys[key]
+	if !found {
+		return
+	}
+	entry := p.unlink(el)
+	if entry.freq == p.minFreq && p.freqs[entry.freq] == nil {
+		p.minFreq++
+	}
+	entry.freq++
+	p.keys[key] = p.push(entry)
+}
+
+func (p *lfuPolicy) Remove(key string) {
+	el, found := p.keys[key]
+	if !found {
+		return
+	}
+	entry := p.unlink(el)
+	delete(p.keys, key)
+
+	// min frequency is lazily fixed in Victim()
+	if entry.freq == p.minFreq && p.freqs[entry.freq] == nil {
+		p.minFreq = 0
+	}
+}
+
+func (p *lfuPolicy) Victim() (string, bool) {
+	if len(p.keys) == 0 {
+		return "", false
+	}
+	l, found := p.freqs[p.minFreq]
+	if !found {
+		// happens just after removal of the last least frequent key
+		p.minFreq = 0
+		for freq := range p.freqs {
+			if p.minFreq == 0 || freq < p.minFreq {
+				p.minFreq = freq
+			}
+		}
+		l = p.freqs[p.minFreq]
+	}
+	return l.Front().Value.(*lfuEntry).key, true
+}
+
+// Random victim. Keys are kept in slice so they can be picked and removed in O(1).
+type randomPolicy struct {
+	keys    []string
+	indexes map[string]int
+}
+
+func newRandomPolicy() *randomPolicy {
+	return &randomPolicy{indexes: make(map[string]int)}
+}
+
+func (p *randomPolicy) Add(key string) {
+	if _, found := p.indexes[key]; !found {
+		p.indexes[key] = len(p.keys)
+		p.keys = append(p.keys, key)
+	}
+}
+
+func (p *randomPolicy) Access(key string) {}
+
+func (p *randomPolicy) Remove(key string) {
+	i, found := p.indexes[key]
+	if !found {
+		return
+	}
+	// swap with the last one and shrink
+	last := len(p.keys) - 1
+	p.keys[i] = p.keys[last]
+	p.indexes[p.keys[i]] = i
+	p.keys = p.keys[:last]
+	delete(p.indexes, key)
+}
+
+func (p *randomPolicy) Victim() (string, bool) {
+	if len(p.keys) == 0 {
+		return "", false
+	}
+	return p.keys[rand.Intn(len(p.keys))], true
+}
@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"testing"
+
+	types "tohan.net/go-practice/src/cache/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRUPolicy(t *testing.T) {
+	policy := NewEvictionPolicy(types.EvictionLRU)
+	policy.Add("1")
+	policy.Add("2")
+	policy.Add("3")
+
+	policy.Access("1")
+	victim, _ := policy.Victim()
+	assert.Equal(t, "2", victim, "least recently used key should be evicted")
+
+	policy.Remove("2")
+	victim, _ = policy.Victim()
+	assert.Equal(t, "3", victim, "removed key shouldnt be returned")
+}
+
+func TestLFUPolicy(t *testing.T) {
+	policy := NewEvictionPolicy(types.EvictionLFU)
+	policy.Add("1")
+	policy.Add("2")
+	policy.Add("3")
+
+	policy.Access("1")
+	policy.Access("1")
+	policy.Access("2")
+	victim, _ := policy.Victim()
+	assert.Equal(t, "3", victim, "least frequently used key should be evicted")
+
+	policy.Remove("3")
+	victim, _ = policy.Victim()
+	assert.Equal(t, "2", victim, "min frequency should be recomputed after removal")
+
+	policy.Add("4")
+	victim, _ = policy.Victim()
+	assert.Equal(t, "4", victim, "new key has the lowest frequency")
+}
+
+func TestFIFOPolicy(t *testing.T) {
+	policy := NewEvictionPolicy(types.EvictionFIFO)
+	policy.Add("1")
+	policy.Add("2")
+
+	policy.Access("1")
+	policy.Add("1")
+	victim, _ := policy.Victim()
+	assert.Equal(t, "1", victim, "access shouldnt change the order")
+}
+
+func TestRandomPolicy(t *testing.T) {
+	policy := NewEvictionPolicy(types.EvictionRandom)
+	_, found := policy.Victim()
+	assert.False(t, found, "empty policy shouldnt return victim")
+
+	policy.Add("1")
+	policy.Add("2")
+	policy.Remove("1")
+	victim, found := policy.Victim()
+	assert.True(t, found, "victim should be found")
+	assert.Equal(t, "2", victim, "only remaining key should be returned")
+}
+
+func TestCache_AddItemEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := prepareBrandNewCache()
+	cache.Config.Capacity = 2
+
+	cache.AddItem(types.CacheItem{Key: "hot", Value: "1"})
+	cache.AddItem(types.CacheItem{Key: "cold", Value: "2"})
+	cache.GetItem("hot")
+	cache.AddItem(types.CacheItem{Key: "new", Value: "3"})
+
+	_, found := cache.GetItem("hot")
+	assert.True(t, found, "recently read item shouldnt be evicted")
+	_, found = cache.GetItem("cold")
+	assert.False(t, found, "least recently used item should be evicted")
+	assert.Equal(t, int64(2), cache.Size(), "cache size should respect capacity")
+}
@@ -0,0 +1,98 @@
+package cache
+
+import (
+	"container/heap"
+)
+
+// How many expired items are removed under one lock by default
+const DefaultExpBatchSize = 1000
+
+type expirationEntry struct {
+	key          string
+	expirationAt int64
+	index        int // position in the heap
+}
+
+// Min-heap of items by their expiration. Implements `heap.Interface`.
+type expirationHeap []*expirationEntry
+
+func (h expirationHeap) Len() int { return len(h) }
+
+func (h expirationHeap) Less(i, j int) bool { return h[i].expirationAt < h[j].expirationAt }
+
+func (h expirationHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expirationHeap) Push(x interface{}) {
+	entry := x.(*expirationEntry)
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+
+func (h *expirationHeap) Pop() interface{} {
+	old := *h
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return entry
+}
+
+// Index of expiration times so janitor doesn't have to scan the whole store.
+// Items that never expire are not indexed. Not safe for concurrent use.
+type expirationIndex struct {
+	heap    expirationHeap
+	entries map[string]*expirationEntry
+}
+
+func newExpirationIndex() *expirationIndex {
+	return &expirationIndex{entries: make(map[string]*expirationEntry)}
+}
+
+// Insert or update expiration of the key. 0 removes it from index.
+func (idx *expirationIndex) Set(key string, expirationAt int64) {
+	if expirationAt == 0 {
+		idx.Remove(key)
+		return
+	}
+	if entry, found := idx.entries[key]; found {
+		entry.expirationAt = expirationAt
+		heap.Fix(&idx.heap, entry.index)
+		return
+	}
+	entry := &expirationEntry{key: key, expirationAt: expirationAt}
+	heap.Push(&idx.heap, entry)
+	idx.entries[key] = entry
+}
+
+func (idx *expirationIndex) Get(key string) (int64, bool) {
+	entry, found := idx.entries[key]
+	if !found {
+		return 0, false
+	}
+	return entry.expirationAt, true
+}
+
+func (idx *expirationIndex) Len() int {
+	return idx.heap.Len()
+}
+
+func (idx *expirationIndex) Remove(key string) {
+	if entry, found := idx.entries[key]; found {
+		heap.Remove(&idx.heap, entry.index)
+		delete(idx.entries, key)
+	}
+}
+
+// Removes from index and returns at most `limit` keys expired at `now`.
+func (idx *expirationIndex) PopExpired(now int64, limit int) []string {
+	keys := []string{}
+	for len(keys) < limit && idx.heap.Len() > 0 && idx.heap[0].expirationAt <= now {
+		entry := heap.Pop(&idx.heap).(*expirationEntry)
+		delete(idx.entries, entry.key)
+		keys = append(keys, entry.key)
+	}
+	return keys
+}
@@ -0,0 +1,35 @@
+package cache
+
+import (
+	"testing"
+
+	types "tohan.net/go-practice/src/cache/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpirationIndex(t *testing.T) {
+	idx := newExpirationIndex()
+	idx.Set("3", 30)
+	idx.Set("1", 10)
+	idx.Set("2", 20)
+	idx.Set("never", 0)
+
+	idx.Set("3", 5) // update
+	idx.Remove("2")
+
+	assert.Equal(t, []string{"3"}, idx.PopExpired(9, 10), "only expired keys should be returned")
+	assert.Equal(t, []string{"1"}, idx.PopExpired(100, 10), "removed and not expiring keys shouldnt be returned")
+	assert.Empty(t, idx.PopExpired(100, 10), "index should be empty")
+}
+
+func TestCache_RemoveExpiredItemsInBatches(t *testing.T) {
+	cache := prepareBrandNewCache()
+	cache.Config.ExpBatchSize = 3
+	cache.FillWithDefaultDataAsExpired()
+	cache.AddItem(types.CacheItem{Key: "fresh", Value: "1"})
+
+	cache.RemoveExpiredItems()
+	assert.Equal(t, int64(1), cache.Size(), "all expired items should be removed")
+	assert.Equal(t, 1, cache.expirations.heap.Len(), "only fresh item should stay in index")
+}
@@ -0,0 +1,313 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+
+	types "tohan.net/go-practice/src/cache/types"
+)
+
+// Built-in export formats
+const (
+	ExportJSONLines = "jsonl"    // one JSON object per line
+	ExportCSV       = "csv"      // header and one row per item
+	ExportProtobuf  = "protobuf" // varint length and `Item` message from export.proto per item
+	ExportKeyValue  = "kv"       // `KEY:VALUE` per line, without metadata
+)
+
+// How many items are copied under one read lock during export
+const ExportPageSize = 1000
+
+var ErrUnknownExportFormat = errors.New("cache: unknown export format")
+
+// Encodes exported items one by one.
+type IExporter interface {
+	Write(record types.ItemRecord) error
+	Flush() error
+}
+
+// Creates exporter writing into `w`. TTL and metadata are exported only `withMeta`.
+type ExporterFactory func(w io.Writer, withMeta bool) IExporter
+
+var exporters = struct {
+	factories map[string]ExporterFactory
+	sync.RWMutex
+}{factories: map[string]ExporterFactory{
+	ExportJSONLines: NewJSONLinesExporter,
+	ExportCSV:       NewCSVExporter,
+	ExportProtobuf:  NewProtobufExporter,
+	ExportKeyValue:  NewKeyValueExporter,
+}}
+
+// Add new export format or replace the existing one.
+func RegisterExporter(format string, factory ExporterFactory) {
+	exporters.Lock()
+	defer exporters.Unlock()
+
+	exporters.factories[format] = factory
+}
+
+func NewExporter(format string, w io.Writer, withMeta bool) (IExporter, error) {
+	exporters.RLock()
+	factory, found := exporters.factories[format]
+	exporters.RUnlock()
+
+	if !found {
+		return nil, ErrUnknownExportFormat
+	}
+	return factory(w, withMeta), nil
+}
+
+// Writes all items in the format in key order. Items are copied page by page, so slow writer
+// doesn't block the cache and the whole cache isn't copied at once. Keys written during export may be missed.
+func (cache *Cache) Export(w io.Writer, format string, withMeta bool) error {
+	exporter, err := NewExporter(format, w, withMeta)
+	if err != nil {
+		return err
+	}
+	if err := cache.exportTo(exporter); err != nil {
+		return err
+	}
+	return exporter.Flush()
+}
+
+func (cache *Cache) exportTo(exporter IExporter) error {
+	from := ""
+	for {
+		records, next, more := cache.recordsPage(from, ExportPageSize)
+		for _, record := range records {
+			if err := exporter.Write(record); err != nil {
+				return err
+			}
+		}
+		if !more {
+			return nil
+		}
+		from = next
+	}
+}
+
+// Copy of at most `limit` items with metadata from key `from` in key order.
+// Returns key of the next page and whether there is any.
+func (cache *Cache) recordsPage(from string, limit int) ([]types.ItemRecord, string, bool) {
+	cache.m.RLock()
+	defer cache.m.RUnlock()
+
+	records := make([]types.ItemRecord, 0, limit)
+	next := ""
+	cache.keys.Ascend(from, func(key string) bool {
+		if len(records) == limit {
+			next = key
+			return false
+		}
+		wrappedItem := cache.Store[key]
+		records = append(records, wrappedItem.ToRecord())
+		return true
+	})
+	return records, next, next != ""
+}
+
+// Copy of all items with metadata
+func (cache *Cache) records() []types.ItemRecord {
+	cache.m.RLock()
+	defer cache.m.RUnlock()
+
+	records := make([]types.ItemRecord, 0, len(cache.Store))
+	for _, wrappedItem := range cache.Store {
+		records = append(records, wrappedItem.ToRecord())
+	}
+	return records
+}
+
+// Item without TTL, expiration and other metadata
+func withoutMeta(record types.ItemRecord) types.CacheItem {
+	item := record.Item
+	item.TTL = 0
+	item.Sliding = false
+	return item
+}
+
+type jsonLinesExporter struct {
+	w        *bufio.Writer
+	encoder  *json.Encoder
+	withMeta bool
+}
+
+// Item per line. It is `types.ItemRecord` with metadata, `types.CacheItem` without them.
+func NewJSONLinesExporter(w io.Writer, withMeta bool) IExporter {
+	bw := bufio.NewWriter(w)
+	return &jsonLinesExporter{w: bw, encoder: json.NewEncoder(bw), withMeta: withMeta}
+}
+
+func (exporter *jsonLinesExporter) Write(record types.ItemRecord) error {
+	if exporter.withMeta {
+		return exporter.encoder.Encode(record)
+	}
+	return exporter.encoder.Encode(withoutMeta(record))
+}
+
+func (exporter *jsonLinesExporter) Flush() error {
+	return exporter.w.Flush()
+}
+
+var (
+	csvHeader     = []string{"key", "value", "content_type"}
+	csvMetaHeader = []string{"ttl", "sliding", "expiration_at", "created_at", "updated_at", "accessed_at", "access_count", "version", "stale"}
+)
+
+type csvExporter struct {
+	w             *csv.Writer
+	withMeta      bool
+	headerWritten bool
+}
+
+// Binary payloads are base64 encoded, see `content_type` column.
+func NewCSVExporter(w io.Writer, withMeta bool) IExporter {
+	return &csvExporter{w: csv.NewWriter(w), withMeta: withMeta}
+}
+
+func (exporter *csvExporter) writeHeader() error {
+	if exporter.headerWritten {
+		return nil
+	}
+	exporter.headerWritten = true
+	header := csvHeader
+	if exporter.withMeta {
+		header = append(append([]string{}, csvHeader...), csvMetaHeader...)
+	}
+	return exporter.w.Write(header)
+}
+
+func (exporter *csvExporter) Write(record types.ItemRecord) error {
+	if err := exporter.writeHeader(); err != nil {
+		return err
+	}
+	item := record.Item
+	row := []string{item.Key, item.ValueString(), item.ContentType}
+	if exporter.withMeta {
+		meta := record.Meta
+		row = append(row,
+			strconv.FormatInt(int64(item.TTL), 10),
+			strconv.FormatBool(item.Sliding),
+			strconv.FormatInt(meta.ExpirationAt, 10),
+			strconv.FormatInt(meta.CreatedAt, 10),
+			strconv.FormatInt(meta.UpdatedAt, 10),
+			strconv.FormatInt(meta.AccessedAt, 10),
+			strconv.FormatInt(meta.AccessCount, 10),
+			strconv.FormatUint(meta.Version, 10),
+			strconv.FormatBool(meta.Stale),
+		)
+	}
+	return exporter.w.Write(row)
+}
+
+func (exporter *csvExporter) Flush() error {
+	// header is written even if there are no items
+	if err := exporter.writeHeader(); err != nil {
+		return err
+	}
+	exporter.w.Flush()
+	return exporter.w.Error()
+}
+
+type keyValueExporter struct {
+	w *bufio.Writer
+}
+
+// Format of `Dump`, it can be imported back as `kv`. Binary payloads are base64 encoded.
+func NewKeyValueExporter(w io.Writer, withMeta bool) IExporter {
+	return &keyValueExporter{w: bufio.NewWriter(w)}
+}
+
+func (exporter *keyValueExporter) Write(record types.ItemRecord) error {
+	_, err := fmt.Fprintf(exporter.w, "%s:%s\n", record.Item.Key, record.Item.ValueString())
+	return err
+}
+
+func (exporter *keyValueExporter) Flush() error {
+	return exporter.w.Flush()
+}
+
+// Protobuf wire types
+const (
+	protoVarint = 0
+	protoBytes  = 2
+)
+
+type protobufExporter struct {
+	w        *bufio.Writer
+	withMeta bool
+}
+
+// Messages are encoded by hand, schema is in export.proto. Zero values are omitted like in proto3.
+func NewProtobufExporter(w io.Writer, withMeta bool) IExporter {
+	return &protobufExporter{w: bufio.NewWriter(w), withMeta: withMeta}
+}
+
+func protoTag(buffer *proto.Buffer, field uint64, wireType uint64) {
+	buffer.EncodeVarint(field<<3 | wireType)
+}
+
+func protoVarintField(buffer *proto.Buffer, field uint64, value uint64) {
+	if value != 0 {
+		protoTag(buffer, field, protoVarint)
+		buffer.EncodeVarint(value)
+	}
+}
+
+func protoBytesField(buffer *proto.Buffer, field uint64, value []byte) {
+	if len(value) != 0 {
+		protoTag(buffer, field, protoBytes)
+		buffer.EncodeRawBytes(value)
+	}
+}
+
+func protoBool(value bool) uint64 {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+func (exporter *protobufExporter) Write(record types.ItemRecord) error {
+	item := record.Item
+	message := proto.NewBuffer(nil)
+	protoBytesField(message, 1, []byte(item.Key))
+	protoBytesField(message, 2, []byte(item.Value))
+	protoBytesField(message, 3, item.Payload)
+	protoBytesField(message, 4, []byte(item.ContentType))
+
+	if exporter.withMeta {
+		// negative int32 is encoded as 64-bit varint
+		protoVarintField(message, 5, uint64(int64(item.TTL)))
+		protoVarintField(message, 6, protoBool(item.Sliding))
+
+		meta := proto.NewBuffer(nil)
+		protoVarintField(meta, 1, uint64(record.Meta.ExpirationAt))
+		protoVarintField(meta, 2, uint64(record.Meta.CreatedAt))
+		protoVarintField(meta, 3, uint64(record.Meta.UpdatedAt))
+		protoVarintField(meta, 4, uint64(record.Meta.AccessedAt))
+		protoVarintField(meta, 5, uint64(record.Meta.AccessCount))
+		protoVarintField(meta, 6, record.Meta.Version)
+		protoVarintField(meta, 7, protoBool(record.Meta.Stale))
+		protoBytesField(message, 7, meta.Bytes())
+	}
+
+	if _, err := exporter.w.Write(proto.EncodeVarint(uint64(len(message.Bytes())))); err != nil {
+		return err
+	}
+	_, err := exporter.w.Write(message.Bytes())
+	return err
+}
+
+func (exporter *protobufExporter) Flush() error {
+	return exporter.w.Flush()
+}
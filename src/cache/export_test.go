@@ -0,0 +1,182 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	types "tohan.net/go-practice/src/cache/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Messages from export.proto, so the export is decoded by the protobuf library
+type exportedItemPB struct {
+	Key         string          `protobuf:"bytes,1,opt,name=key,proto3"`
+	Value       string          `protobuf:"bytes,2,opt,name=value,proto3"`
+	Payload     []byte          `protobuf:"bytes,3,opt,name=payload,proto3"`
+	ContentType string          `protobuf:"bytes,4,opt,name=content_type,proto3"`
+	TTL         int32           `protobuf:"varint,5,opt,name=ttl,proto3"`
+	Sliding     bool            `protobuf:"varint,6,opt,name=sliding,proto3"`
+	Meta        *exportedMetaPB `protobuf:"bytes,7,opt,name=meta,proto3"`
+}
+
+func (m *exportedItemPB) Reset()         { *m = exportedItemPB{} }
+func (m *exportedItemPB) String() string { return proto.CompactTextString(m) }
+func (*exportedItemPB) ProtoMessage()    {}
+
+type exportedMetaPB struct {
+	ExpirationAt int64  `protobuf:"varint,1,opt,name=expiration_at,proto3"`
+	CreatedAt    int64  `protobuf:"varint,2,opt,name=created_at,proto3"`
+	UpdatedAt    int64  `protobuf:"varint,3,opt,name=updated_at,proto3"`
+	AccessedAt   int64  `protobuf:"varint,4,opt,name=accessed_at,proto3"`
+	AccessCount  int64  `protobuf:"varint,5,opt,name=access_count,proto3"`
+	Version      uint64 `protobuf:"varint,6,opt,name=version,proto3"`
+	Stale        bool   `protobuf:"varint,7,opt,name=stale,proto3"`
+}
+
+func (m *exportedMetaPB) Reset()         { *m = exportedMetaPB{} }
+func (m *exportedMetaPB) String() string { return proto.CompactTextString(m) }
+func (*exportedMetaPB) ProtoMessage()    {}
+
+func prepareCacheForExport() *MockCache {
+	cache := prepareBrandNewCache()
+	cache.AddItem(types.CacheItem{Key: "colon:key", Value: "multi\nline, \"quoted\" value"})
+	cache.AddItemWithTTL(types.CacheItem{Key: "forever", Value: "1"}, types.NoExpiration)
+	cache.AddItem(types.NewPayloadItem("binary", []byte{0, 1, 2}, types.ContentTypeBinary))
+	return cache
+}
+
+func TestCache_ExportJSONLines(t *testing.T) {
+	cache := prepareCacheForExport()
+
+	buffer := bytes.Buffer{}
+	assert.Nil(t, cache.Export(&buffer, ExportJSONLines, false), "items should be exported")
+	scanner := bufio.NewScanner(&buffer)
+	count := 0
+	for ; scanner.Scan(); count++ {
+		item := types.CacheItem{}
+		assert.Nil(t, json.Unmarshal(scanner.Bytes(), &item), "every line should be JSON")
+		assert.Equal(t, cache.Store[item.Key].Bytes(), item.Bytes(), "value should be exported as it is")
+		assert.Equal(t, int32(0), item.TTL, "TTL shouldnt be exported without meta")
+	}
+	assert.Equal(t, 3, count, "all items should be exported")
+
+	buffer.Reset()
+	assert.Nil(t, cache.Export(&buffer, ExportJSONLines, true), "items should be exported")
+	record := types.ItemRecord{}
+	json.Unmarshal([]byte(strings.SplitN(buffer.String(), "\n", 2)[0]), &record)
+	assert.Equal(t, cache.Store[record.Item.Key].Version, record.Meta.Version, "metadata should be exported")
+}
+
+func TestCache_ExportCSV(t *testing.T) {
+	cache := prepareCacheForExport()
+
+	buffer := bytes.Buffer{}
+	assert.Nil(t, cache.Export(&buffer, ExportCSV, true), "items should be exported")
+	rows, err := csv.NewReader(&buffer).ReadAll()
+	assert.Nil(t, err, "export should be valid CSV")
+	assert.Equal(t, 4, len(rows), "header and all items should be exported")
+	assert.Equal(t, "key", rows[0][0], "header should be first")
+	for _, row := range rows[1:] {
+		wrappedItem := cache.Store[row[0]]
+		assert.Equal(t, wrappedItem.ValueString(), row[1], "value should be quoted properly")
+		assert.Equal(t, len(csvHeader)+len(csvMetaHeader), len(row), "meta should be exported")
+		if row[0] == "forever" {
+			assert.Equal(t, "-1", row[3], "TTL should be exported")
+		}
+	}
+
+	buffer.Reset()
+	assert.Nil(t, prepareBrandNewCache().Export(&buffer, ExportCSV, false), "empty cache should be exported")
+	assert.Equal(t, "key,value,content_type\n", buffer.String(), "header should be exported even without items")
+}
+
+func TestCache_ExportProtobuf(t *testing.T) {
+	cache := prepareCacheForExport()
+
+	buffer := bytes.Buffer{}
+	assert.Nil(t, cache.Export(&buffer, ExportProtobuf, true), "items should be exported")
+	data := buffer.Bytes()
+	count := 0
+	for ; len(data) > 0; count++ {
+		length, n := proto.DecodeVarint(data)
+		assert.True(t, n > 0 && n+int(length) <= len(data), "message should be length delimited")
+		message := data[n : n+int(length)]
+		data = data[n+int(length):]
+		item := exportedItemPB{}
+		assert.Nil(t, proto.Unmarshal(message, &item), "message should be decoded")
+
+		wrappedItem := cache.Store[item.Key]
+		assert.Equal(t, wrappedItem.Value, item.Value, "value should be exported")
+		assert.Equal(t, wrappedItem.Payload, item.Payload, "payload should be exported")
+		assert.Equal(t, wrappedItem.TTL, item.TTL, "TTL should be exported")
+		assert.Equal(t, wrappedItem.Version, item.Meta.Version, "metadata should be exported")
+		assert.Equal(t, wrappedItem.ExpirationAt, item.Meta.ExpirationAt, "metadata should be exported")
+	}
+	assert.Equal(t, 3, count, "all items should be exported")
+}
+
+func TestCache_ExportUnknownFormat(t *testing.T) {
+	cache := prepareCacheForExport()
+	assert.Equal(t, ErrUnknownExportFormat, cache.Export(&bytes.Buffer{}, "xml", false), "unknown format should be rejected")
+
+	RegisterExporter("keys", func(w io.Writer, withMeta bool) IExporter { return &keysExporter{w} })
+	buffer := bytes.Buffer{}
+	assert.Nil(t, cache.Export(&buffer, "keys", false), "registered format should be used")
+	assert.Equal(t, 3, strings.Count(buffer.String(), "\n"), "registered format should get all items")
+}
+
+type keysExporter struct {
+	w io.Writer
+}
+
+func (exporter *keysExporter) Write(record types.ItemRecord) error {
+	_, err := fmt.Fprintln(exporter.w, record.Item.Key)
+	return err
+}
+
+func (exporter *keysExporter) Flush() error {
+	return nil
+}
+
+func TestCache_ExportPages(t *testing.T) {
+	cache := NewCache(types.CacheConfig{TTL: 100})
+	count := ExportPageSize*2 + 1
+	for i := 0; i < count; i++ {
+		key := fmt.Sprintf("%05d", i)
+		cache.AddItem(types.CacheItem{Key: key, Value: key})
+	}
+
+	RegisterExporter("keys", func(w io.Writer, withMeta bool) IExporter { return &keysExporter{w} })
+	buffer := bytes.Buffer{}
+	assert.Nil(t, cache.Export(&buffer, "keys", false), "items should be exported")
+	keys := strings.Split(strings.TrimSuffix(buffer.String(), "\n"), "\n")
+	assert.Equal(t, count, len(keys), "items of all pages should be exported")
+	for i, key := range keys {
+		if key != fmt.Sprintf("%05d", i) {
+			t.Fatalf("item %d exported as %s, items should be exported once in key order", i, key)
+		}
+	}
+}
+
+func TestCache_Dump(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "dump")
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "dumpster.txt")
+
+	cache := prepareCacheForExport()
+	cache.Dump(filename)
+	content, _ := ioutil.ReadFile(filename)
+	assert.Equal(t, "binary:AAEC\ncolon:key:multi\nline, \"quoted\" value\nforever:1\n", string(content), "items should be dumped as KEY:VALUE lines")
+}
@@ -0,0 +1,65 @@
+package cache
+
+import (
+	types "tohan.net/go-practice/src/cache/types"
+)
+
+// Why the item was removed
+const (
+	RemovalEvicted = "evicted" // to make a space for another item
+	RemovalExpired = "expired" // by `RemoveExpiredItems` or when expired item was read
+	RemovalDeleted = "deleted" // by `RemoveItem` or transaction
+	RemovalFlushed = "flushed" // by `RemoveAllItems`
+)
+
+// Called with removed item and reason of the removal. It is called under the cache lock,
+// so it must not call methods of the cache and slow work should be done in goroutine.
+type RemovalHook func(item types.CacheItem, reason string)
+
+// Hook called when item is evicted because of capacity.
+func (cache *Cache) OnEvict(hook RemovalHook) {
+	cache.m.Lock()
+	defer cache.m.Unlock()
+
+	cache.onEvict = append(cache.onEvict, hook)
+}
+
+// Hook called when expired item is removed.
+func (cache *Cache) OnExpire(hook RemovalHook) {
+	cache.m.Lock()
+	defer cache.m.Unlock()
+
+	cache.onExpire = append(cache.onExpire, hook)
+}
+
+// Hook called when item is removed explicitly or by flush of the cache.
+func (cache *Cache) OnDelete(hook RemovalHook) {
+	cache.m.Lock()
+	defer cache.m.Unlock()
+
+	cache.onDelete = append(cache.onDelete, hook)
+}
+
+// Removes the item, notifies watchers and calls hooks. Caller must hold the write lock.
+func (cache *Cache) removeBecause(key string, reason string) {
+	previous, exists := cache.Store[key]
+	cache.remove(key)
+	if !exists {
+		return
+	}
+
+	var eventType string
+	var hooks []RemovalHook
+	switch reason {
+	case RemovalEvicted:
+		eventType, hooks = types.EventEvict, cache.onEvict
+	case RemovalExpired:
+		eventType, hooks = types.EventExpire, cache.onExpire
+	default:
+		eventType, hooks = types.EventDelete, cache.onDelete
+	}
+	cache.notify(eventType, key, &previous.CacheItem, nil)
+	for _, hook := range hooks {
+		hook(previous.ToCacheItem(), reason)
+	}
+}
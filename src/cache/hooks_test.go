@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"testing"
+
+	types "tohan.net/go-practice/src/cache/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type removal struct {
+	key    string
+	reason string
+}
+
+func TestCache_RemovalHooks(t *testing.T) {
+	cache := prepareBrandNewCache()
+	cache.Config.Capacity = 2
+	removals := []removal{}
+	record := func(item types.CacheItem, reason string) {
+		removals = append(removals, removal{item.Key, reason})
+	}
+	cache.OnEvict(record)
+	cache.OnExpire(record)
+	cache.OnDelete(record)
+
+	cache.AddItem(types.CacheItem{Key: "1", Value: "1"})
+	cache.AddItem(types.CacheItem{Key: "2", Value: "2"})
+	cache.AddItem(types.CacheItem{Key: "3", Value: "3"})
+	cache.RemoveItem("2")
+	cache.RemoveItem("missing")
+	cache.RemoveAllItems()
+	cache.FillWithDefaultDataAsExpired()
+	cache.GetItem("one")
+
+	assert.Equal(t, []removal{
+		{"1", RemovalEvicted},
+		{"2", RemovalDeleted},
+		{"3", RemovalFlushed},
+		{"one", RemovalExpired},
+	}, removals, "hooks should be called with reason of removal")
+
+	removals = removals[:0]
+	cache.RemoveExpiredItems()
+	assert.Equal(t, len(defaultTestKeyValues)-1, len(removals), "expired items should be passed to hook")
+}
+
+func TestCache_OnlyMatchingHooks(t *testing.T) {
+	cache := prepareBrandNewCache()
+	cache.Config.Capacity = 1
+	evicted := []types.CacheItem{}
+	cache.OnEvict(func(item types.CacheItem, reason string) {
+		evicted = append(evicted, item)
+	})
+
+	cache.AddItem(types.CacheItem{Key: "1", Value: "first"})
+	cache.RemoveItem("1")
+	cache.AddItem(types.CacheItem{Key: "2", Value: "second"})
+	cache.AddItem(types.CacheItem{Key: "3", Value: "third"})
+
+	assert.Equal(t, 1, len(evicted), "evict hook shouldnt get deleted items")
+	assert.Equal(t, "second", evicted[0].Value, "evict hook should get removed item")
+}
@@ -0,0 +1,233 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	types "tohan.net/go-practice/src/cache/types"
+)
+
+// Import formats. JSON Lines and CSV are the same as in `Export`.
+const (
+	ImportJSONLines = ExportJSONLines
+	ImportCSV       = ExportCSV
+	ImportKeyValue  = "kv" // `KEY:VALUE` or `KEY:VALUE:TTL` per line
+)
+
+// What to do with items which are already in the cache
+const (
+	ImportOverwrite    = "overwrite"
+	ImportSkipExisting = "skip"
+)
+
+// How many errors are reported at most
+const MaxImportErrors = 100
+
+var (
+	ErrUnknownImportFormat = errors.New("cache: unknown import format")
+	ErrUnknownImportPolicy = errors.New("cache: unknown import policy")
+)
+
+type ImportError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+type ImportResult struct {
+	Imported int           `json:"imported"`
+	Skipped  int           `json:"skipped"`  // already existing items
+	Rejected int           `json:"rejected"` // not stored by admission policy or `MaxBytes`
+	Failed   int           `json:"failed"`
+	Errors   []ImportError `json:"errors"` // first `MaxImportErrors` of failed lines
+}
+
+// Called for every item read from the input, `err` is set if the line is malformed.
+type importFunc func(line int, item types.CacheItem, err error)
+
+// Reads items from the input line by line and inserts them into the cache, so the input doesn't have to fit into memory.
+// Malformed lines are reported in the result, returned error means the input couldn't be read.
+func (cache *Cache) Import(r io.Reader, format string, policy string) (ImportResult, error) {
+	result := ImportResult{Errors: []ImportError{}}
+	if policy != ImportOverwrite && policy != ImportSkipExisting {
+		return result, ErrUnknownImportPolicy
+	}
+
+	var read func(r io.Reader, fn importFunc) error
+	switch format {
+	case ImportJSONLines:
+		read = readJSONLines
+	case ImportCSV:
+		read = readCSV
+	case ImportKeyValue:
+		read = readKeyValues
+	default:
+		return result, ErrUnknownImportFormat
+	}
+
+	err := read(r, func(line int, item types.CacheItem, err error) {
+		if err == nil && item.Key == "" {
+			err = errors.New("missing key")
+		} else if err == nil && !item.HasValidTTL() {
+			err = ErrInvalidTTL
+		}
+		if err != nil {
+			result.Failed++
+			if len(result.Errors) < MaxImportErrors {
+				result.Errors = append(result.Errors, ImportError{Line: line, Message: err.Error()})
+			}
+			return
+		}
+
+		write := cache.Upsert
+		if policy == ImportSkipExisting {
+			write = cache.AddIfAbsent
+		}
+		switch _, err := write(item); err {
+		case nil:
+			result.Imported++
+		case ErrPreconditionFailed:
+			result.Skipped++
+		default:
+			result.Rejected++
+		}
+	})
+	return result, err
+}
+
+func (cache *Cache) ImportFromFile(filename string, format string, policy string) (ImportResult, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	defer file.Close()
+
+	return cache.Import(file, format, policy)
+}
+
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	return scanner
+}
+
+// Lines can be `types.CacheItem` or `types.ItemRecord` (export with metadata). Metadata are ignored.
+func readJSONLines(r io.Reader, fn importFunc) error {
+	scanner := newLineScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		data := scanner.Bytes()
+		if len(strings.TrimSpace(string(data))) == 0 {
+			continue
+		}
+		record := types.ItemRecord{}
+		if err := json.Unmarshal(data, &record); err != nil {
+			fn(line, types.CacheItem{}, err)
+			continue
+		}
+		if record.Item.Key != "" {
+			fn(line, record.Item, nil)
+			continue
+		}
+		item := types.CacheItem{}
+		err := json.Unmarshal(data, &item)
+		fn(line, item, err)
+	}
+	return scanner.Err()
+}
+
+func readKeyValues(r io.Reader, fn importFunc) error {
+	scanner := newLineScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		item, err := parseKeyValue(text)
+		fn(line, item, err)
+	}
+	return scanner.Err()
+}
+
+// Columns are found by the header, `key` is required. Errors are reported with number of the row instead of line.
+// `value` of binary content type is base64 encoded.
+func readCSV(r io.Reader, fn importFunc) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	if _, found := columns["key"]; !found {
+		return errors.New("cache: CSV header without `key` column")
+	}
+
+	// rows are counted instead of lines, quoted values can contain new lines
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if parseErr, ok := err.(*csv.ParseError); ok {
+			fn(row, types.CacheItem{}, parseErr.Err)
+			continue
+		} else if err != nil {
+			return err
+		}
+		item, err := csvItem(record, columns)
+		fn(row, item, err)
+	}
+}
+
+func csvItem(row []string, columns map[string]int) (types.CacheItem, error) {
+	column := func(name string) string {
+		if i, found := columns[name]; found && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+
+	item := types.CacheItem{Key: column("key"), ContentType: column("content_type")}
+	value := column("value")
+	if item.ContentType == "" {
+		item.Value = value
+	} else if item.IsText() {
+		item.Payload = []byte(value)
+	} else {
+		payload, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return item, fmt.Errorf("value of binary item is not base64 encoded: %v", err)
+		}
+		item.Payload = payload
+	}
+
+	if ttl := column("ttl"); ttl != "" {
+		parsed, err := strconv.ParseInt(ttl, 10, 32)
+		if err != nil {
+			return item, errTTLFormat
+		}
+		item.TTL = int32(parsed)
+	}
+	if sliding := column("sliding"); sliding != "" {
+		parsed, err := strconv.ParseBool(sliding)
+		if err != nil {
+			return item, fmt.Errorf("sliding is not boolean: %v", err)
+		}
+		item.Sliding = parsed
+	}
+	return item, nil
+}
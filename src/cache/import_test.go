@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	types "tohan.net/go-practice/src/cache/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_ImportExported(t *testing.T) {
+	for _, format := range []string{ImportJSONLines, ImportCSV} {
+		for _, withMeta := range []bool{false, true} {
+			cache := prepareCacheForExport()
+			buffer := bytes.Buffer{}
+			cache.Export(&buffer, format, withMeta)
+
+			imported := prepareBrandNewCache()
+			result, err := imported.Import(&buffer, format, ImportOverwrite)
+			assert.Nil(t, err, "export should be imported: "+format)
+			assert.Equal(t, 3, result.Imported, "all items should be imported: "+format)
+			assert.Empty(t, result.Errors, "there shouldnt be errors: "+format)
+			for key, wrappedItem := range cache.Store {
+				assert.Equal(t, wrappedItem.Bytes(), imported.Store[key].Bytes(), "value should be imported: "+format)
+				assert.Equal(t, wrappedItem.ContentType, imported.Store[key].ContentType, "content type should be imported: "+format)
+			}
+			if withMeta {
+				assert.Equal(t, int64(0), imported.Store["forever"].ExpirationAt, "TTL should be imported: "+format)
+			}
+		}
+	}
+}
+
+func TestCache_ImportKeyValue(t *testing.T) {
+	input := "GO:LANG\nPY:THON:-1\n\nbroken\nTTL:wrong:abc\n:no key\nTTL:negative:-5\n"
+	cache := prepareBrandNewCache()
+
+	result, err := cache.Import(strings.NewReader(input), ImportKeyValue, ImportOverwrite)
+	assert.Nil(t, err, "input should be read")
+	assert.Equal(t, 2, result.Imported, "valid lines should be imported")
+	assert.Equal(t, 4, result.Failed, "malformed lines should fail")
+	assert.Equal(t, []ImportError{
+		{Line: 4, Message: errKeyValueFormat.Error()},
+		{Line: 5, Message: errTTLFormat.Error()},
+		{Line: 6, Message: "missing key"},
+		{Line: 7, Message: errTTLFormat.Error()},
+	}, result.Errors, "errors should be reported with line numbers")
+	assert.Equal(t, int64(0), cache.Store["PY"].ExpirationAt, "TTL should be imported")
+}
+
+func TestCache_ImportSkipExisting(t *testing.T) {
+	cache := prepareBrandNewCache()
+	cache.AddItem(types.CacheItem{Key: "GO", Value: "existing"})
+
+	result, _ := cache.Import(strings.NewReader("GO:LANG\nPY:THON\n"), ImportKeyValue, ImportSkipExisting)
+	assert.Equal(t, 1, result.Imported, "new items should be imported")
+	assert.Equal(t, 1, result.Skipped, "existing items should be skipped")
+	assert.Equal(t, "existing", cache.Store["GO"].Value, "existing item shouldnt be overwritten")
+
+	result, _ = cache.Import(strings.NewReader("GO:LANG\n"), ImportKeyValue, ImportOverwrite)
+	assert.Equal(t, 1, result.Imported, "existing items should be overwritten")
+	assert.Equal(t, "LANG", cache.Store["GO"].Value, "existing item should be overwritten")
+}
+
+func TestCache_ImportErrors(t *testing.T) {
+	cache := prepareBrandNewCache()
+
+	_, err := cache.Import(strings.NewReader(""), "xml", ImportOverwrite)
+	assert.Equal(t, ErrUnknownImportFormat, err, "unknown format should be rejected")
+	_, err = cache.Import(strings.NewReader(""), ImportKeyValue, "merge")
+	assert.Equal(t, ErrUnknownImportPolicy, err, "unknown policy should be rejected")
+	_, err = cache.Import(strings.NewReader("name,value\na,b\n"), ImportCSV, ImportOverwrite)
+	assert.NotNil(t, err, "CSV without key column should be rejected")
+
+	input := "{\"key\":\"a\",\"value\":\"1\"}\n{broken\n"
+	result, err := cache.Import(strings.NewReader(input), ImportJSONLines, ImportOverwrite)
+	assert.Nil(t, err, "input should be read")
+	assert.Equal(t, 1, result.Failed, "malformed line should fail")
+	assert.Equal(t, 2, result.Errors[0].Line, "line of error should be reported")
+
+	input = "key,value,content_type\nbin,!!!," + types.ContentTypeBinary + "\n\"unclosed,1\n"
+	result, _ = cache.Import(strings.NewReader(input), ImportCSV, ImportOverwrite)
+	assert.Equal(t, 2, result.Failed, "malformed rows should fail")
+
+	result, _ = cache.Import(strings.NewReader("{\"key\":\"neg\",\"value\":\"1\",\"ttl\":-5}\n"), ImportJSONLines, ImportOverwrite)
+	assert.Equal(t, []ImportError{{Line: 1, Message: ErrInvalidTTL.Error()}}, result.Errors, "TTL below NoExpiration should be rejected")
+}
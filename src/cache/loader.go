@@ -0,0 +1,157 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	types "tohan.net/go-practice/src/cache/types"
+)
+
+// Loader should return it when the origin doesn't know the key
+var ErrNotFound = errors.New("cache: item not found")
+
+var errLoaderPanicked = errors.New("cache: loader panicked")
+
+// Loads missing or expired item from the origin (read-through).
+type Loader func(key string) (types.CacheItem, error)
+
+type loadCall struct {
+	wg          sync.WaitGroup
+	wrappedItem types.CacheItemWrapper
+	err         error
+}
+
+// Collapses concurrent loads of the same key into one call (singleflight).
+type loadGroup struct {
+	calls     map[string]*loadCall
+	refreshes map[string]struct{} // keys refreshed in background
+	sync.Mutex
+}
+
+func (g *loadGroup) Do(key string, fn func() (types.CacheItemWrapper, error)) (types.CacheItemWrapper, error) {
+	g.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*loadCall)
+	}
+	if call, found := g.calls[key]; found {
+		g.Unlock()
+		call.wg.Wait()
+		return call.wrappedItem, call.err
+	}
+	// waiters get this error if `fn` panics
+	call := &loadCall{err: errLoaderPanicked}
+	call.wg.Add(1)
+	g.calls[key] = call
+	g.Unlock()
+
+	defer func() {
+		g.Lock()
+		delete(g.calls, key)
+		g.Unlock()
+		call.wg.Done()
+	}()
+
+	call.wrappedItem, call.err = fn()
+	return call.wrappedItem, call.err
+}
+
+// Marks background refresh of the key. False if the key is being loaded already.
+func (g *loadGroup) startRefresh(key string) bool {
+	g.Lock()
+	defer g.Unlock()
+
+	if _, found := g.calls[key]; found {
+		return false
+	}
+	if _, found := g.refreshes[key]; found {
+		return false
+	}
+	if g.refreshes == nil {
+		g.refreshes = make(map[string]struct{})
+	}
+	g.refreshes[key] = struct{}{}
+	return true
+}
+
+func (g *loadGroup) endRefresh(key string) {
+	g.Lock()
+	defer g.Unlock()
+
+	delete(g.refreshes, key)
+}
+
+// Set loader used by `GetItem` on miss. Loaded items get the normal TTL.
+func (cache *Cache) SetLoader(loader Loader) {
+	cache.m.Lock()
+	defer cache.m.Unlock()
+
+	cache.loader = loader
+}
+
+// Loads the item and saves it into the cache unless the key was written meanwhile.
+// `version` is version of the missed or stale item, 0 if it was missing. Caller must not hold the lock.
+func (cache *Cache) load(key string, loader Loader, version uint64) (types.CacheItemWrapper, bool) {
+	wrappedItem, err := cache.loads.Do(key, func() (types.CacheItemWrapper, error) {
+		item, err := loader(key)
+
+		cache.m.Lock()
+		defer cache.m.Unlock()
+		cache.stats.Loads++
+		if err != nil && err != ErrNotFound {
+			cache.stats.LoadErrors++
+		}
+		// write or delete during the load is newer than data of the origin
+		if current, exists := cache.Store[key]; current.Version != version {
+			if exists && !current.IsExpired() {
+				return current, nil
+			}
+			if err != nil {
+				return types.CacheItemWrapper{}, err
+			}
+			item.Key = key
+			return types.CacheItemWrapper{CacheItem: item}, nil
+		}
+
+		if err == ErrNotFound {
+			// origin doesn't know it anymore, so stale item can't be served
+			if wrappedItem, found := cache.Store[key]; found && wrappedItem.IsExpired() {
+				cache.removeBecause(key, RemovalExpired)
+			}
+			if cache.Config.NegativeTTL > 0 {
+				cache.negatives.Set(key, time.Now().Unix()+int64(cache.Config.NegativeTTL))
+			}
+		}
+		if err != nil {
+			return types.CacheItemWrapper{}, err
+		}
+		item.Key = key
+		// item is served even if it's not stored
+		wrappedItem, _ := cache.add(item)
+		return wrappedItem, nil
+	})
+
+	if err != nil {
+		if err != ErrNotFound {
+			fmt.Println("Loading of item failed:", key, err)
+		}
+		return types.CacheItemWrapper{}, false
+	}
+	return wrappedItem, true
+}
+
+// Loads stale item in background, caller has to mark it by `startRefresh`. Panic of the loader can't crash the app, it's counted as load error.
+func (cache *Cache) refresh(key string, loader Loader, version uint64) {
+	defer cache.loads.endRefresh(key)
+	defer func() {
+		if r := recover(); r != nil {
+			cache.m.Lock()
+			cache.stats.Loads++
+			cache.stats.LoadErrors++
+			cache.m.Unlock()
+			fmt.Println("Loading of item failed:", key, r)
+		}
+	}()
+	cache.load(key, loader, version)
+}
@@ -0,0 +1,241 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	types "tohan.net/go-practice/src/cache/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_Loader(t *testing.T) {
+	cache := prepareBrandNewCache()
+	calls := int32(0)
+	cache.SetLoader(func(key string) (types.CacheItem, error) {
+		atomic.AddInt32(&calls, 1)
+		if key == "missing" {
+			return types.CacheItem{}, ErrNotFound
+		}
+		if key == "broken" {
+			return types.CacheItem{}, errors.New("origin is down")
+		}
+		return types.CacheItem{Value: "loaded " + key}, nil
+	})
+
+	item, found := cache.GetItem("one")
+	assert.True(t, found, "missing item should be loaded")
+	assert.Equal(t, "loaded one", item.Value, "loaded item not matching")
+	assert.Equal(t, cache.Config.TTL, cache.Store["one"].TTL, "loaded item should be saved with the normal TTL")
+
+	cache.GetItem("one")
+	assert.Equal(t, int32(1), calls, "cached item shouldnt be loaded again")
+
+	_, found = cache.GetItem("missing")
+	assert.False(t, found, "unknown item shouldnt be found")
+	_, found = cache.GetItem("broken")
+	assert.False(t, found, "item shouldnt be found when loader fails")
+}
+
+func TestCache_LoaderDeduplication(t *testing.T) {
+	cache := prepareBrandNewCache()
+	calls := int32(0)
+	release := make(chan struct{})
+	cache.SetLoader(func(key string) (types.CacheItem, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return types.CacheItem{Value: "loaded"}, nil
+	})
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			item, _ := cache.GetItem("hot")
+			assert.Equal(t, "loaded", item.Value, "all callers should get loaded item")
+		}()
+	}
+	time.Sleep(50 * time.Millisecond) // let all of them wait for the load
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls, "concurrent misses should be loaded just once")
+}
+
+// Refresh of stale item is not started while the previous one runs
+func waitForLoad(cache *Cache, key string) {
+	for !cache.loads.startRefresh(key) {
+		time.Sleep(time.Millisecond)
+	}
+	cache.loads.endRefresh(key)
+}
+
+func TestCache_StaleWhileRevalidate(t *testing.T) {
+	cache := prepareBrandNewCache()
+	cache.Config.StaleGracePeriod = 60
+	refreshed := make(chan struct{}, 1)
+	fail := int32(1)
+	cache.SetLoader(func(key string) (types.CacheItem, error) {
+		defer func() {
+			select {
+			case refreshed <- struct{}{}:
+			default:
+			}
+		}()
+		if atomic.LoadInt32(&fail) == 1 {
+			return types.CacheItem{}, errors.New("origin is down")
+		}
+		return types.CacheItem{Value: "fresh"}, nil
+	})
+
+	// items expired just now
+	cache.FillWithDefaultData()
+	for key := range defaultTestKeyValues {
+		wrappedItem := cache.Store[key]
+		wrappedItem.ExpirationAt = time.Now().Unix() - 1
+		cache.setWrapped(wrappedItem)
+	}
+	cache.RemoveExpiredItems()
+	assert.Equal(t, int64(len(defaultTestKeyValues)), cache.Size(), "stale items should be kept during grace period")
+
+	// failed refresh
+	item, meta, found := cache.GetItemWithMeta("one")
+	assert.True(t, found, "stale item should be returned")
+	assert.True(t, meta.Stale, "item should be marked as stale")
+	assert.Equal(t, defaultTestKeyValues["one"], item.Value, "stale value should be returned")
+	<-refreshed
+	waitForLoad(cache.Cache, "one")
+	_, meta, found = cache.GetItemWithMeta("one")
+	assert.True(t, found && meta.Stale, "stale item should be served when refresh fails")
+	<-refreshed
+	waitForLoad(cache.Cache, "one")
+
+	// successful refresh
+	atomic.StoreInt32(&fail, 0)
+	cache.GetItem("one")
+	<-refreshed
+	// refreshed item is saved after loader returns
+	assert.Eventually(t, func() bool {
+		item, meta, _ = cache.GetItemWithMeta("one")
+		return !meta.Stale && item.Value == "fresh"
+	}, time.Second, time.Millisecond, "refreshed item should be returned")
+}
+
+func TestCache_StaleAfterGracePeriod(t *testing.T) {
+	cache := prepareBrandNewCache()
+	cache.Config.StaleGracePeriod = 60
+	cache.SetLoader(func(key string) (types.CacheItem, error) {
+		return types.CacheItem{}, errors.New("origin is down")
+	})
+	cache.AddItem(types.CacheItem{Key: "old", Value: "1"})
+	wrappedItem := cache.Store["old"]
+	wrappedItem.ExpirationAt = time.Now().Unix() - 61
+	cache.setWrapped(wrappedItem)
+
+	_, found := cache.GetItem("old")
+	assert.False(t, found, "stale item shouldnt be served after grace period")
+}
+
+func TestCache_NegativeCaching(t *testing.T) {
+	cache := prepareBrandNewCache()
+	cache.Config.NegativeTTL = 60
+	calls := int32(0)
+	cache.SetLoader(func(key string) (types.CacheItem, error) {
+		atomic.AddInt32(&calls, 1)
+		return types.CacheItem{}, ErrNotFound
+	})
+
+	_, found := cache.GetItem("missing")
+	assert.False(t, found, "unknown item shouldnt be found")
+	assert.True(t, cache.IsNegative("missing"), "unknown item should be remembered")
+	_, found = cache.GetItem("missing")
+	assert.False(t, found, "unknown item shouldnt be found")
+	assert.Equal(t, int32(1), calls, "loader shouldnt be called for known missing item")
+
+	stats := cache.Stats()
+	assert.Equal(t, int64(1), stats.NegativeItems, "negative item should be counted")
+	assert.Equal(t, int64(1), stats.NegativeHits, "negative hit should be counted")
+	assert.Equal(t, int64(0), stats.Items, "negative item shouldnt be counted as item")
+
+	cache.AddItem(types.CacheItem{Key: "missing", Value: "1"})
+	assert.False(t, cache.IsNegative("missing"), "added item shouldnt be negative")
+
+	// expired negative item
+	cache.negatives.Set("old", time.Now().Unix()-1)
+	cache.RemoveExpiredItems()
+	assert.Equal(t, int64(0), cache.Stats().NegativeItems, "expired negative items should be removed")
+}
+
+func TestCache_LoadDoesntOverwriteNewerWrite(t *testing.T) {
+	cache := prepareBrandNewCache()
+	loading, release := make(chan struct{}), make(chan struct{})
+	cache.SetLoader(func(key string) (types.CacheItem, error) {
+		close(loading)
+		<-release
+		return types.CacheItem{Value: "origin"}, nil
+	})
+
+	result := make(chan types.CacheItem)
+	go func() {
+		item, _ := cache.GetItem("key")
+		result <- item
+	}()
+	<-loading
+	cache.AddItem(types.CacheItem{Key: "key", Value: "newer"})
+	close(release)
+
+	assert.Equal(t, "newer", (<-result).Value, "newer write should be returned")
+	assert.Equal(t, "newer", cache.Store["key"].Value, "newer write shouldnt be overwritten by loaded item")
+}
+
+func TestCache_LoaderPanic(t *testing.T) {
+	cache := prepareBrandNewCache()
+	cache.SetLoader(func(key string) (types.CacheItem, error) {
+		panic("broken loader")
+	})
+
+	assert.Panics(t, func() { cache.GetItem("key") }, "panic should be propagated")
+	cache.SetLoader(func(key string) (types.CacheItem, error) {
+		return types.CacheItem{Value: "loaded"}, nil
+	})
+	done := make(chan struct{})
+	go func() {
+		cache.GetItem("key")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("load after panic shouldnt hang")
+	}
+}
+
+func TestCache_StaleRefreshPanic(t *testing.T) {
+	cache := prepareBrandNewCache()
+	cache.Config.StaleGracePeriod = 60
+	release := make(chan struct{})
+	cache.SetLoader(func(key string) (types.CacheItem, error) {
+		<-release
+		panic("broken loader")
+	})
+	cache.AddItem(types.CacheItem{Key: "one", Value: "1"})
+	wrappedItem := cache.Store["one"]
+	wrappedItem.ExpirationAt = time.Now().Unix() - 1
+	cache.setWrapped(wrappedItem)
+
+	for i := 0; i < 10; i++ {
+		_, meta, found := cache.GetItemWithMeta("one")
+		assert.True(t, found && meta.Stale, "stale item should be served while it's refreshed")
+	}
+	close(release)
+	assert.Eventually(t, func() bool {
+		return cache.Stats().LoadErrors == 1
+	}, time.Second, time.Millisecond, "panic should be counted as load error just for one refresh")
+	waitForLoad(cache.Cache, "one")
+	_, found := cache.GetItem("one")
+	assert.True(t, found, "stale item should be served after failed refresh")
+}
@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+
+	types "tohan.net/go-practice/src/cache/types"
+)
+
+const readBufferSize = 128
+
+// Accesses of items read under the read lock. They are applied to eviction policy, admission
+// policy and metadata under the write lock later, so reads don't block each other.
+// It's lossy - accesses are dropped while it's full, eviction is just a bit less precise then.
+type readBuffer struct {
+	keys [readBufferSize]string
+	at   [readBufferSize]int64
+	next uint64 // first free slot, over the size when the buffer is full
+}
+
+// Caller must hold the read lock. Returns true if the buffer got full and should be drained.
+func (buffer *readBuffer) record(key string, at int64) bool {
+	i := atomic.AddUint64(&buffer.next, 1) - 1
+	if i >= readBufferSize {
+		return false
+	}
+	buffer.keys[i] = key
+	buffer.at[i] = at
+	return i == readBufferSize-1
+}
+
+// Returns living item under the read lock and records the access into the read buffer.
+// Items which have to be changed by the read (expired or sliding) aren't returned.
+func (cache *Cache) getShared(key string) (types.CacheItemWrapper, bool) {
+	cache.m.RLock()
+	wrappedItem, found := cache.Store[key]
+	if !found || wrappedItem.Sliding || wrappedItem.IsExpired() {
+		cache.m.RUnlock()
+		return types.CacheItemWrapper{}, false
+	}
+	now := time.Now().Unix()
+	atomic.AddInt64(&cache.stats.Hits, 1)
+	isFull := cache.reads.record(key, now)
+	cache.m.RUnlock()
+
+	if isFull {
+		cache.m.Lock()
+		cache.drainReads()
+		cache.m.Unlock()
+	}
+	wrappedItem.AccessedAt = now
+	wrappedItem.AccessCount++
+	return wrappedItem, true
+}
+
+// Applies accesses of the read buffer. Caller must hold the write lock.
+func (cache *Cache) drainReads() {
+	count := cache.reads.next
+	if count > readBufferSize {
+		count = readBufferSize
+	}
+	for i := uint64(0); i < count; i++ {
+		key := cache.reads.keys[i]
+		cache.reads.keys[i] = ""
+		if cache.admission != nil {
+			cache.admission.Record(key)
+		}
+		wrappedItem, found := cache.Store[key]
+		if !found {
+			continue
+		}
+		cache.eviction.Access(key)
+		if cache.reads.at[i] > wrappedItem.AccessedAt {
+			wrappedItem.AccessedAt = cache.reads.at[i]
+		}
+		wrappedItem.AccessCount++
+		// only metadata are changed, so indexes and size stay the same
+		cache.Store[key] = wrappedItem
+	}
+	cache.reads.next = 0
+}
@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	types "tohan.net/go-practice/src/cache/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_ReadBuffer(t *testing.T) {
+	cache := prepareBrandNewCache()
+	cache.AddItem(types.CacheItem{Key: "one", Value: "1"})
+
+	reads := readBufferSize * 3
+	for i := 0; i < reads; i++ {
+		cache.GetItem("one")
+	}
+	_, meta, _ := cache.GetItemWithMeta("one")
+	assert.Equal(t, int64(reads+1), meta.AccessCount, "reads should be applied when buffer gets full")
+	assert.Equal(t, int64(reads+1), cache.Stats().Hits, "hits shouldnt be lost")
+
+	cache.GetItem("one")
+	_, meta, _ = cache.GetItemWithMeta("one")
+	assert.Equal(t, int64(reads+1), meta.AccessCount, "buffered reads arent in metadata until the buffer is drained")
+}
+
+func TestCache_ReadBufferIsLossy(t *testing.T) {
+	cache := prepareBrandNewCache()
+	cache.AddItem(types.CacheItem{Key: "one", Value: "1"})
+	cache.AddItem(types.CacheItem{Key: "removed", Value: "2"})
+
+	// fill the buffer over its size without draining it
+	for i := 0; i < readBufferSize+10; i++ {
+		cache.reads.record("one", 0)
+	}
+	cache.reads.keys[0] = "removed"
+	cache.RemoveItem("removed")
+	cache.AddItem(types.CacheItem{Key: "other", Value: "3"})
+	assert.Equal(t, uint64(0), cache.reads.next, "buffer should be drained by write")
+	assert.Equal(t, int64(readBufferSize-1), cache.Store["one"].AccessCount, "reads over the buffer size should be dropped")
+	_, found := cache.Store["removed"]
+	assert.False(t, found, "reads of removed item shouldnt bring it back")
+}
+
+func TestCache_ConcurrentReads(t *testing.T) {
+	cache := prepareBrandNewCache()
+	cache.Config.Capacity = 50
+	for i := 0; i < 50; i++ {
+		cache.AddItem(types.CacheItem{Key: strconv.Itoa(i), Value: "1"})
+	}
+
+	wg := sync.WaitGroup{}
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				cache.GetItem(strconv.Itoa(i % 50))
+				if i%100 == 0 {
+					cache.AddItem(types.CacheItem{Key: strconv.Itoa(g*1000 + i), Value: "2"})
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	assert.Equal(t, int64(8000), cache.Stats().Hits+cache.Stats().Misses, "every read should be counted")
+	assert.Equal(t, int64(50), cache.Size(), "capacity should be kept")
+}
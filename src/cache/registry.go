@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	types "tohan.net/go-practice/src/cache/types"
+)
+
+// Name of the namespace used when none is chosen
+const DefaultNamespace = "default"
+
+var ErrNamespaceExists = errors.New("cache: namespace already exists")
+
+// Named caches in one process. Every namespace has its own keyspace and config.
+type Registry struct {
+	caches map[string]*Cache
+	sync.RWMutex
+}
+
+func NewRegistry() *Registry {
+	return &Registry{caches: make(map[string]*Cache)}
+}
+
+// Creates cache of the namespace.
+func (registry *Registry) Create(name string, config types.CacheConfig) (*Cache, error) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if _, found := registry.caches[name]; found {
+		return nil, ErrNamespaceExists
+	}
+	cache := NewCache(config)
+	registry.caches[name] = cache
+	return cache, nil
+}
+
+func (registry *Registry) Get(name string) (*Cache, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	cache, found := registry.caches[name]
+	return cache, found
+}
+
+// Names of all namespaces in alphabetical order
+func (registry *Registry) Names() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	names := make([]string, 0, len(registry.caches))
+	for name := range registry.caches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
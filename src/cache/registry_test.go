@@ -0,0 +1,35 @@
+package cache
+
+import (
+	"testing"
+
+	types "tohan.net/go-practice/src/cache/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	config := NewMockCache().Config
+
+	sentiments, err := registry.Create("sentiments", config)
+	assert.Nil(t, err, "namespace should be created")
+	config.Capacity = 1
+	random, _ := registry.Create(DefaultNamespace, config)
+	_, err = registry.Create("sentiments", config)
+	assert.Equal(t, ErrNamespaceExists, err, "namespace shouldnt be created twice")
+
+	sentiments.AddItem(types.CacheItem{Key: "key", Value: "sentiment"})
+	random.AddItem(types.CacheItem{Key: "key", Value: "random"})
+	random.AddItem(types.CacheItem{Key: "other", Value: "random"})
+
+	found, ok := registry.Get("sentiments")
+	assert.True(t, ok, "namespace should be found")
+	item, _ := found.GetItem("key")
+	assert.Equal(t, "sentiment", item.Value, "namespaces should have own keyspaces")
+	assert.Equal(t, int64(1), random.Size(), "namespaces should have own config")
+
+	_, ok = registry.Get("missing")
+	assert.False(t, ok, "unknown namespace shouldnt be found")
+	assert.Equal(t, []string{DefaultNamespace, "sentiments"}, registry.Names(), "names should be sorted")
+}
@@ -0,0 +1,244 @@
+package cache
+
+import (
+	"encoding/base64"
+	"errors"
+	"math/rand"
+	"strings"
+	"unicode/utf8"
+
+	types "tohan.net/go-practice/src/cache/types"
+)
+
+// Page size of `Scan` if limit is not set
+const DefaultScanLimit = 100
+
+// Max page size of `Scan`
+const MaxScanLimit = 10000
+
+// How many keys `Scan` examines per requested item. Keeps the lock short
+// when only few keys match, the page is shorter then.
+const ScanExamineFactor = 10
+
+var ErrInvalidCursor = errors.New("cache: invalid scan cursor")
+
+// Returns page of living items matching the glob `pattern` in key order and cursor of the next page.
+// Start with empty cursor, scanning is done when the returned cursor is empty. Page can be shorter
+// than `limit` (even empty) and still have the next one. Keys written during scanning may be missed.
+// Pattern supports `*` (any text), `?` (one character) and `\` (escape). Empty pattern matches all keys.
+func (cache *Cache) Scan(cursor string, pattern string, limit int) ([]types.CacheItem, string, error) {
+	if limit <= 0 {
+		limit = DefaultScanLimit
+	} else if limit > MaxScanLimit {
+		limit = MaxScanLimit
+	}
+	lastKey, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// only keys with literal prefix of the pattern can match
+	prefix := globPrefix(pattern)
+	from := prefix
+	if cursor != "" && lastKey+"\x00" > from {
+		from = lastKey + "\x00" // first key after the cursor
+	}
+
+	cache.m.RLock()
+	defer cache.m.RUnlock()
+
+	items := []types.CacheItem{}
+	examined := 0
+	next := ""
+	cache.keys.Ascend(from, func(key string) bool {
+		if !strings.HasPrefix(key, prefix) {
+			return false
+		}
+		if len(items) == limit || examined == limit*ScanExamineFactor {
+			next = encodeCursor(lastKey)
+			return false
+		}
+		examined++
+		lastKey = key
+		if pattern == "" || matchGlob(pattern, key) {
+			// expired items are removed by janitor, scan holds just the read lock
+			if wrappedItem := cache.Store[key]; !wrappedItem.IsExpired() {
+				items = append(items, wrappedItem.ToCacheItem())
+			}
+		}
+		return true
+	})
+	return items, next, nil
+}
+
+// Cursor is the last examined key, encoded so it can be used in URL
+func encodeCursor(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+func decodeCursor(cursor string) (string, error) {
+	key, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", ErrInvalidCursor
+	}
+	return string(key), nil
+}
+
+// Escapes text so it matches just itself in `Scan` pattern
+func EscapeGlob(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		if r == '*' || r == '?' || r == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Text before the first wildcard of the pattern
+func globPrefix(pattern string) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '*', '?':
+			return b.String()
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+			}
+		}
+		b.WriteByte(pattern[i])
+	}
+	return b.String()
+}
+
+// Greedy matching - on mismatch only the last star takes one more character,
+// so it's O(len(pattern) * len(text)) for any number of stars.
+func matchGlob(pattern string, text string) bool {
+	p, t := 0, 0
+	star, starText := -1, 0 // position of the last star and text matched since it
+	for t < len(text) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				star, starText = p, t
+				p++
+				continue
+			case '?':
+				_, size := utf8.DecodeRuneInString(text[t:])
+				p, t = p+1, t+size
+				continue
+			default:
+				literal, width := pattern[p], 1
+				if literal == '\\' && p+1 < len(pattern) {
+					literal, width = pattern[p+1], 2
+				}
+				if text[t] == literal {
+					p, t = p+width, t+1
+					continue
+				}
+			}
+		}
+		if star < 0 {
+			return false
+		}
+		_, size := utf8.DecodeRuneInString(text[starText:])
+		starText += size
+		p, t = star+1, starText
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// Enough levels for billions of keys
+const keyIndexMaxLevel = 24
+
+type keyIndexNode struct {
+	key  string
+	next []*keyIndexNode // next node on every level
+}
+
+// Keys in sorted order (skip list), so scans can start anywhere
+// without sorting the whole store. Not safe for concurrent use.
+type keyIndex struct {
+	head  *keyIndexNode
+	level int
+	size  int
+	rand  *rand.Rand
+}
+
+func newKeyIndex() *keyIndex {
+	return &keyIndex{
+		head:  &keyIndexNode{next: make([]*keyIndexNode, keyIndexMaxLevel)},
+		level: 1,
+		rand:  rand.New(rand.NewSource(rand.Int63())),
+	}
+}
+
+// Returns first node with key >= `key`. Fills `update` with the last node before it on every level.
+func (idx *keyIndex) seek(key string, update []*keyIndexNode) *keyIndexNode {
+	node := idx.head
+	for level := idx.level - 1; level >= 0; level-- {
+		for node.next[level] != nil && node.next[level].key < key {
+			node = node.next[level]
+		}
+		if update != nil {
+			update[level] = node
+		}
+	}
+	return node.next[0]
+}
+
+func (idx *keyIndex) Add(key string) {
+	update := make([]*keyIndexNode, keyIndexMaxLevel)
+	if node := idx.seek(key, update); node != nil && node.key == key {
+		return
+	}
+
+	// every level has quarter of nodes of the level below
+	level := 1
+	for level < keyIndexMaxLevel && idx.rand.Intn(4) == 0 {
+		level++
+	}
+	for ; idx.level < level; idx.level++ {
+		update[idx.level] = idx.head
+	}
+
+	node := &keyIndexNode{key: key, next: make([]*keyIndexNode, level)}
+	for i := 0; i < level; i++ {
+		node.next[i] = update[i].next[i]
+		update[i].next[i] = node
+	}
+	idx.size++
+}
+
+func (idx *keyIndex) Remove(key string) {
+	update := make([]*keyIndexNode, keyIndexMaxLevel)
+	node := idx.seek(key, update)
+	if node == nil || node.key != key {
+		return
+	}
+	for i := range node.next {
+		update[i].next[i] = node.next[i]
+	}
+	for idx.level > 1 && idx.head.next[idx.level-1] == nil {
+		idx.level--
+	}
+	idx.size--
+}
+
+func (idx *keyIndex) Len() int {
+	return idx.size
+}
+
+// Calls `fn` for keys >= `from` in order until it returns false.
+func (idx *keyIndex) Ascend(from string, fn func(key string) bool) {
+	for node := idx.seek(from, nil); node != nil; node = node.next[0] {
+		if !fn(node.key) {
+			return
+		}
+	}
+}
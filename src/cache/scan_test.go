@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	types "tohan.net/go-practice/src/cache/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyIndex(t *testing.T) {
+	idx := newKeyIndex()
+	for i := 0; i < 500; i++ {
+		idx.Add(fmt.Sprintf("key-%d", (i*7919)%500)) // shuffled
+	}
+	idx.Add("key-1") // duplicate
+	idx.Remove("key-2")
+	idx.Remove("missing")
+
+	keys := []string{}
+	idx.Ascend("", func(key string) bool {
+		keys = append(keys, key)
+		return true
+	})
+	assert.Equal(t, 499, idx.Len(), "duplicates and removed keys shouldnt be counted")
+	assert.Equal(t, 499, len(keys), "all keys should be visited")
+	assert.True(t, sort.StringsAreSorted(keys), "keys should be sorted")
+	assert.NotContains(t, keys, "key-2", "removed key shouldnt be visited")
+
+	first := ""
+	idx.Ascend("key-45", func(key string) bool {
+		first = key
+		return false
+	})
+	assert.Equal(t, "key-45", first, "ascending should start at the key")
+}
+
+func TestCache_Scan(t *testing.T) {
+	cache := prepareBrandNewCache()
+	for i := 0; i < 25; i++ {
+		cache.AddItem(types.CacheItem{Key: fmt.Sprintf("BTC:%02d", i), Value: "btc"})
+		cache.AddItem(types.CacheItem{Key: fmt.Sprintf("ETH:%02d", i), Value: "eth"})
+	}
+	cache.setWrapped(types.CacheItemWrapper{CacheItem: types.CacheItem{Key: "BTC:expired"}, ExpirationAt: 1})
+	cache.RemoveItem("BTC:13")
+
+	keys := []string{}
+	cursor, pages := "", 0
+	for {
+		items, next, err := cache.Scan(cursor, EscapeGlob("BTC:")+"*", 10)
+		assert.Nil(t, err, "scan should succeed")
+		for _, item := range items {
+			keys = append(keys, item.Key)
+		}
+		pages++
+		if cursor = next; cursor == "" {
+			break
+		}
+	}
+	assert.Equal(t, 3, pages, "items should be split into pages")
+	assert.Equal(t, 24, len(keys), "all living items with prefix should be scanned")
+	assert.True(t, sort.StringsAreSorted(keys), "items should be in key order")
+	assert.NotContains(t, keys, "BTC:13", "removed item shouldnt be scanned")
+	assert.NotContains(t, keys, "BTC:expired", "expired item shouldnt be scanned")
+
+	items, next, _ := cache.Scan("", "*:?5", 100)
+	assert.Equal(t, 4, len(items), "glob should match BTC:05, BTC:15, ETH:05 and ETH:15")
+	assert.Equal(t, "", next, "last page should have empty cursor")
+
+	_, _, err := cache.Scan("not base64!", "", 10)
+	assert.Equal(t, ErrInvalidCursor, err, "invalid cursor should be rejected")
+}
+
+func TestCache_ScanExaminesLimitedKeys(t *testing.T) {
+	cache := prepareBrandNewCache()
+	for i := 0; i < 100; i++ {
+		cache.AddItem(types.CacheItem{Key: fmt.Sprintf("key-%03d", i), Value: "1"})
+	}
+
+	items, next, _ := cache.Scan("", "*-099", 1)
+	assert.Empty(t, items, "page should be empty when examined keys dont match")
+	assert.NotEqual(t, "", next, "scanning should continue with the next page")
+
+	items, _, _ = cache.Scan("", "*-099", 0)
+	assert.Equal(t, 1, len(items), "default limit should examine all keys")
+}
+
+func TestMatchGlob(t *testing.T) {
+	assert.True(t, matchGlob("BTC:*", "BTC:1"), "star should match any text")
+	assert.True(t, matchGlob("*", ""), "star should match empty text")
+	assert.True(t, matchGlob("?:ž", "a:ž"), "question mark should match one character")
+	assert.False(t, matchGlob("?", "ab"), "question mark shouldnt match two characters")
+	assert.True(t, matchGlob(`a\*`, "a*"), "escaped star should match itself")
+	assert.False(t, matchGlob(`a\*`, "ab"), "escaped star shouldnt match other text")
+	assert.True(t, matchGlob("*b*", "abc"), "stars should backtrack")
+	assert.False(t, matchGlob("a*b", "ab c"), "pattern should match the whole text")
+	assert.Equal(t, "a*b", globPrefix(`a\*b*c`), "prefix should end at the first wildcard")
+
+	start := time.Now()
+	assert.False(t, matchGlob("*a*a*a*a*a*b", strings.Repeat("a", 60)), "pathological pattern shouldnt match")
+	assert.True(t, time.Since(start) < 10*time.Millisecond, "matching should be linear in number of stars")
+}
@@ -0,0 +1,142 @@
+package cache
+
+import (
+	"hash/fnv"
+	"io"
+	"os"
+
+	types "tohan.net/go-practice/src/cache/types"
+)
+
+// Default number of shards if it's not set in config
+const DefaultShardsCount = 16
+
+// Cache split into independent shards by hash of the key,
+// so writers of different keys don't fight over one lock.
+// Capacity is divided between shards and every shard evicts on its own.
+type ShardedCache struct {
+	Config        types.CacheConfig
+	Shards        []*Cache
+	InputAdapters []IAdapter
+}
+
+func NewShardedCache(config types.CacheConfig) *ShardedCache {
+	if config.Shards <= 0 {
+		config.Shards = DefaultShardsCount
+	}
+
+	shardConfig := config
+	shardConfig.GetAdaptersDataFrequency = 0 // adapters are collected by sharded cache itself
+	if config.Capacity > 0 {
+		shardConfig.Capacity = (config.Capacity + int64(config.Shards) - 1) / int64(config.Shards)
+	}
+	if config.MaxBytes > 0 {
+		shardConfig.MaxBytes = (config.MaxBytes + int64(config.Shards) - 1) / int64(config.Shards)
+	}
+
+	cache := &ShardedCache{Config: config}
+	for i := int32(0); i < config.Shards; i++ {
+		cache.Shards = append(cache.Shards, NewCache(shardConfig))
+	}
+
+	// Collect data from adapters.
+	if cache.Config.GetAdaptersDataFrequency > 0 {
+		go executePeriodic(cache.Config.GetAdaptersDataFrequency, cache.CollectAdaptersData)
+	}
+	return cache
+}
+
+// Returns shard responsible for the key (FNV-1a hash)
+func (cache *ShardedCache) shard(key string) *Cache {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return cache.Shards[h.Sum32()%uint32(len(cache.Shards))]
+}
+
+func (cache *ShardedCache) SetInputAdapter(adapter IAdapter) {
+	cache.InputAdapters = append(cache.InputAdapters, adapter)
+}
+
+func (cache *ShardedCache) CollectAdaptersData() {
+	for _, adapter := range cache.InputAdapters {
+		for _, item := range adapter.GetData() {
+			cache.AddItem(*item)
+		}
+	}
+}
+
+func (cache *ShardedCache) Size() int64 {
+	size := int64(0)
+	for _, shard := range cache.Shards {
+		shard.m.RLock()
+		size += shard.Size()
+		shard.m.RUnlock()
+	}
+	return size
+}
+
+func (cache *ShardedCache) AddItem(item types.CacheItem) {
+	cache.shard(item.Key).AddItem(item)
+}
+
+func (cache *ShardedCache) AddItemWithTTL(item types.CacheItem, ttl int32) error {
+	return cache.shard(item.Key).AddItemWithTTL(item, ttl)
+}
+
+func (cache *ShardedCache) GetItem(key string) (types.CacheItem, bool) {
+	return cache.shard(key).GetItem(key)
+}
+
+func (cache *ShardedCache) Touch(key string) bool {
+	return cache.shard(key).Touch(key)
+}
+
+func (cache *ShardedCache) GetAllItems() *[]types.CacheItem {
+	items := []types.CacheItem{}
+	for _, shard := range cache.Shards {
+		items = append(items, *shard.GetAllItems()...)
+	}
+	return &items
+}
+
+func (cache *ShardedCache) RemoveItem(key string) {
+	cache.shard(key).RemoveItem(key)
+}
+
+func (cache *ShardedCache) RemoveAllItems() {
+	for _, shard := range cache.Shards {
+		shard.RemoveAllItems()
+	}
+}
+
+func (cache *ShardedCache) RemoveExpiredItems() {
+	for _, shard := range cache.Shards {
+		shard.RemoveExpiredItems()
+	}
+}
+
+func (cache *ShardedCache) Dump(filename string) {
+	file, err := os.Create(filename)
+
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+
+	if err := cache.Export(file, ExportKeyValue, false); err != nil {
+		panic(err)
+	}
+}
+
+func (cache *ShardedCache) Export(w io.Writer, format string, withMeta bool) error {
+	exporter, err := NewExporter(format, w, withMeta)
+	if err != nil {
+		return err
+	}
+	for _, shard := range cache.Shards {
+		if err := shard.exportTo(exporter); err != nil {
+			return err
+		}
+	}
+	return exporter.Flush()
+}
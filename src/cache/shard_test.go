@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+
+	types "tohan.net/go-practice/src/cache/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func prepareShardedCache(shards int32, capacity int64) *ShardedCache {
+	return NewShardedCache(types.CacheConfig{
+		TTL:      30,
+		Capacity: capacity,
+		Shards:   shards,
+	})
+}
+
+func TestShardedCache(t *testing.T) {
+	cache := prepareShardedCache(4, 0)
+	for key, value := range defaultTestKeyValues {
+		cache.AddItem(types.CacheItem{Key: key, Value: value})
+	}
+	assert.Equal(t, int64(len(defaultTestKeyValues)), cache.Size(), "cache size not matching")
+	assert.Equal(t, len(defaultTestKeyValues), len(*cache.GetAllItems()), "not getting all items")
+
+	item, found := cache.GetItem("one")
+	assert.True(t, found, "In case of known item should return true.")
+	assert.Equal(t, defaultTestKeyValues["one"], item.Value, "In case of known item should correct item.")
+
+	cache.RemoveItem("one")
+	_, found = cache.GetItem("one")
+	assert.False(t, found, "removed item shouldnt be found")
+
+	cache.RemoveAllItems()
+	assert.Empty(t, cache.Size(), "cache is not empty")
+}
+
+func TestShardedCache_Capacity(t *testing.T) {
+	cache := prepareShardedCache(4, 10)
+	assert.Equal(t, int64(3), cache.Shards[0].Config.Capacity, "capacity should be split between shards")
+
+	for i := 0; i < 100; i++ {
+		cache.AddItem(types.CacheItem{Key: strconv.Itoa(i), Value: "1"})
+	}
+	for _, shard := range cache.Shards {
+		assert.True(t, shard.Size() <= 3, "shard shouldnt overflow its capacity")
+	}
+}
+
+// Mixed reads and writes from many goroutines
+func benchmarkParallel(b *testing.B, addItem func(types.CacheItem), getItem func(string) (types.CacheItem, bool)) {
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+		addItem(types.CacheItem{Key: keys[i], Value: keys[i]})
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		// goroutines start at random keys, so they don't hit the same keys (and shards) in lockstep
+		i := rand.Intn(len(keys))
+		for pb.Next() {
+			key := keys[i%len(keys)]
+			if i%5 == 0 {
+				addItem(types.CacheItem{Key: key, Value: key})
+			} else {
+				getItem(key)
+			}
+			i++
+		}
+	})
+}
+
+// Only reads from many goroutines
+func benchmarkParallelReads(b *testing.B, addItem func(types.CacheItem), getItem func(string) (types.CacheItem, bool)) {
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+		addItem(types.CacheItem{Key: keys[i], Value: keys[i]})
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		// goroutines start at random keys, so they don't hit the same keys (and shards) in lockstep
+		i := rand.Intn(len(keys))
+		for pb.Next() {
+			getItem(keys[i%len(keys)])
+			i++
+		}
+	})
+}
+
+func BenchmarkCache_Parallel(b *testing.B) {
+	cache := NewCache(types.CacheConfig{TTL: 30})
+	benchmarkParallel(b, cache.AddItem, cache.GetItem)
+}
+
+func BenchmarkShardedCache_Parallel(b *testing.B) {
+	cache := prepareShardedCache(DefaultShardsCount, 0)
+	benchmarkParallel(b, cache.AddItem, cache.GetItem)
+}
+
+func BenchmarkCache_ParallelReads(b *testing.B) {
+	cache := NewCache(types.CacheConfig{TTL: 30})
+	benchmarkParallelReads(b, cache.AddItem, cache.GetItem)
+}
@@ -0,0 +1,75 @@
+package cache
+
+import (
+	types "tohan.net/go-practice/src/cache/types"
+)
+
+// Returns approximate number of bytes used by the item.
+type Sizer func(item types.CacheItem) int64
+
+// Counts bytes of the key, value, payload and content type.
+func DefaultSizer(item types.CacheItem) int64 {
+	return int64(len(item.Key) + len(item.Value) + len(item.Payload) + len(item.ContentType))
+}
+
+// Set function used for `MaxBytes` limit. Size of all items is counted again.
+func (cache *Cache) SetSizer(sizer Sizer) {
+	cache.m.Lock()
+	defer cache.m.Unlock()
+
+	cache.sizer = sizer
+	cache.usedBytes = 0
+	for _, wrappedItem := range cache.Store {
+		cache.usedBytes += cache.sizeOf(wrappedItem.CacheItem)
+	}
+}
+
+// Approximate number of bytes used by all items
+func (cache *Cache) UsedBytes() int64 {
+	cache.m.RLock()
+	defer cache.m.RUnlock()
+
+	return cache.usedBytes
+}
+
+func (cache *Cache) sizeOf(item types.CacheItem) int64 {
+	if cache.sizer == nil {
+		return DefaultSizer(item)
+	}
+	return cache.sizer(item)
+}
+
+// Evicts items until the new version of the item fits into `MaxBytes`.
+// Returns false if the item is bigger than the whole limit. Caller must hold the write lock.
+func (cache *Cache) makeSpaceFor(item types.CacheItem) bool {
+	if cache.Config.MaxBytes <= 0 {
+		return true
+	}
+	size := cache.sizeOf(item)
+	if size > cache.Config.MaxBytes {
+		cache.stats.Oversized++
+		// previous version would be stale
+		cache.removeBecause(item.Key, RemovalEvicted)
+		return false
+	}
+
+	for {
+		usedBytes := cache.usedBytes + size
+		if previous, exists := cache.Store[item.Key]; exists {
+			usedBytes -= cache.sizeOf(previous.CacheItem)
+		}
+		if usedBytes <= cache.Config.MaxBytes {
+			return true
+		}
+		victim, found := cache.eviction.Victim()
+		if !found {
+			return true
+		}
+		if victim == item.Key {
+			// previous version of the item itself is evicted, it is replaced anyway
+			cache.remove(victim)
+			continue
+		}
+		cache.removeBecause(victim, RemovalEvicted)
+	}
+}
@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	types "tohan.net/go-practice/src/cache/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_UsedBytes(t *testing.T) {
+	cache := prepareBrandNewCache()
+
+	cache.AddItem(types.CacheItem{Key: "a", Value: "1234"})
+	cache.AddItem(types.NewPayloadItem("b", []byte{1, 2}, "x"))
+	assert.Equal(t, int64(5+4), cache.UsedBytes(), "keys and values should be counted")
+
+	cache.AddItem(types.CacheItem{Key: "a", Value: "12"})
+	assert.Equal(t, int64(3+4), cache.UsedBytes(), "updated item should be counted again")
+	cache.RemoveItem("b")
+	assert.Equal(t, int64(3), cache.UsedBytes(), "removed item shouldnt be counted")
+	assert.Equal(t, int64(3), cache.Stats().UsedBytes, "used bytes should be in stats")
+
+	cache.SetSizer(func(item types.CacheItem) int64 { return 100 })
+	assert.Equal(t, int64(100), cache.UsedBytes(), "items should be counted again by new sizer")
+	cache.RemoveAllItems()
+	assert.Equal(t, int64(0), cache.UsedBytes(), "flushed cache should be empty")
+}
+
+func TestCache_MaxBytes(t *testing.T) {
+	cache := prepareBrandNewCache()
+	cache.Config.MaxBytes = 30
+
+	cache.AddItem(types.CacheItem{Key: "1", Value: strings.Repeat("x", 9)})
+	cache.AddItem(types.CacheItem{Key: "2", Value: strings.Repeat("x", 9)})
+	cache.AddItem(types.CacheItem{Key: "3", Value: strings.Repeat("x", 9)})
+	assert.Equal(t, int64(3), cache.Size(), "items fitting into limit should be kept")
+
+	cache.AddItem(types.CacheItem{Key: "4", Value: strings.Repeat("x", 19)})
+	assert.True(t, cache.UsedBytes() <= 30, "limit should be kept")
+	_, found := cache.Store["1"]
+	assert.False(t, found, "least recently used items should be evicted")
+	_, found = cache.Store["4"]
+	assert.True(t, found, "new item should be saved")
+
+	cache.AddItem(types.CacheItem{Key: "2", Value: strings.Repeat("x", 25)})
+	assert.True(t, cache.UsedBytes() <= 30, "limit should be kept when item grows")
+	assert.Equal(t, int64(26), cache.UsedBytes(), "grown item should replace the others")
+
+	cache.AddItem(types.CacheItem{Key: "2", Value: strings.Repeat("x", 100)})
+	_, found = cache.Store["2"]
+	assert.False(t, found, "item bigger than limit shouldnt be saved")
+	assert.Equal(t, int64(0), cache.UsedBytes(), "item bigger than limit shouldnt be counted")
+}
+
+func TestCache_MaxBytesGrowingVictim(t *testing.T) {
+	cache := prepareBrandNewCache()
+	cache.Config.MaxBytes = 30
+	cache.AddItem(types.CacheItem{Key: "a", Value: strings.Repeat("x", 9)})
+	cache.AddItem(types.CacheItem{Key: "b", Value: strings.Repeat("x", 9)})
+
+	// `a` is the least recently used, so its previous version is the first victim
+	cache.AddItem(types.CacheItem{Key: "a", Value: strings.Repeat("x", 24)})
+	assert.Equal(t, int64(1), cache.Size(), "other items should be evicted when it's not enough")
+	assert.Equal(t, strings.Repeat("x", 24), cache.Store["a"].Value, "new version of the item should be saved")
+	assert.Equal(t, int64(25), cache.UsedBytes(), "only new version should be counted")
+}
+
+func TestCache_OversizedItemIsNotPersisted(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wal")
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "cache.wal")
+
+	cache := prepareBrandNewCache()
+	cache.Config.MaxBytes = 10
+	store := NewMemoryStore()
+	cache.SetBackingStore(store)
+	assert.Nil(t, cache.OpenWAL(filename, WALSyncAlways, 0), "log should be opened")
+
+	_, err := cache.Upsert(types.CacheItem{Key: "big", Value: strings.Repeat("x", 100)})
+	assert.Equal(t, ErrNotStored, err, "oversized item should be reported")
+	assert.Equal(t, int64(1), cache.Stats().Oversized, "oversized item should be counted")
+	_, found := store.Items["big"]
+	assert.False(t, found, "oversized item shouldnt be written to backing store")
+	assert.Nil(t, cache.CloseWAL(), "log should be closed")
+
+	restored := prepareBrandNewCache()
+	assert.Nil(t, restored.OpenWAL(filename, WALSyncNever, 0), "log should be replayed")
+	defer restored.CloseWAL()
+	assert.Equal(t, int64(0), restored.Size(), "oversized item shouldnt be replayed")
+}
@@ -0,0 +1,163 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	types "tohan.net/go-practice/src/cache/types"
+)
+
+// Snapshot format:
+//
+//	GPCACHE <version>
+//	one JSON encoded `types.ItemRecord` per line
+//	CRC32 <checksum of all record lines> <number of records>
+const (
+	snapshotMagic   = "GPCACHE"
+	snapshotVersion = 1
+	snapshotTrailer = "CRC32"
+)
+
+var ErrInvalidSnapshot = errors.New("cache: invalid snapshot")
+
+// Writes all items with their expiration and metadata.
+func (cache *Cache) Snapshot(w io.Writer) error {
+	records := cache.records()
+
+	bw := bufio.NewWriter(w)
+	if _, err := fmt.Fprintf(bw, "%s %d\n", snapshotMagic, snapshotVersion); err != nil {
+		return err
+	}
+	checksum := crc32.NewIEEE()
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		line = append(line, '\n')
+		checksum.Write(line)
+		if _, err := bw.Write(line); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(bw, "%s %08x %d\n", snapshotTrailer, checksum.Sum32(), len(records)); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// Reads snapshot and inserts its items into the cache. Items with the same keys are overwritten,
+// already expired ones are skipped and remove the items with the same keys. Nothing is inserted if the snapshot is corrupted.
+func (cache *Cache) Restore(r io.Reader) error {
+	records, err := readSnapshot(r)
+	if err != nil {
+		return err
+	}
+
+	cache.m.Lock()
+	defer cache.m.Unlock()
+
+	for _, record := range records {
+		cache.putRecord(record)
+	}
+	return nil
+}
+
+// Inserts restored item unless it's already expired. Caller must hold the write lock.
+func (cache *Cache) putRecord(record types.ItemRecord) {
+	wrappedItem := record.ToWrapper()
+	isExpired := wrappedItem.ExpirationAt != 0 && wrappedItem.ExpirationAt <= time.Now().Unix()
+	if isExpired || !cache.put(wrappedItem) {
+		// older value of the key was overwritten by this one, so it can't stay
+		cache.remove(wrappedItem.Key)
+	}
+	// versions have to keep growing after restart
+	if wrappedItem.Version > cache.version {
+		cache.version = wrappedItem.Version
+	}
+}
+
+func readSnapshot(r io.Reader) ([]types.ItemRecord, error) {
+	reader := bufio.NewReader(r)
+
+	header, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, ErrInvalidSnapshot
+	}
+	var version int
+	if _, err := fmt.Sscanf(header, snapshotMagic+" %d\n", &version); err != nil {
+		return nil, ErrInvalidSnapshot
+	}
+	if version != snapshotVersion {
+		return nil, fmt.Errorf("cache: unsupported snapshot version %d", version)
+	}
+
+	records := []types.ItemRecord{}
+	checksum := crc32.NewIEEE()
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			// trailer is missing - snapshot was not written completely
+			return nil, ErrInvalidSnapshot
+		}
+
+		if strings.HasPrefix(line, snapshotTrailer+" ") {
+			var sum uint32
+			var count int
+			if _, err := fmt.Sscanf(line, snapshotTrailer+" %x %d\n", &sum, &count); err != nil {
+				return nil, ErrInvalidSnapshot
+			}
+			if sum != checksum.Sum32() || count != len(records) {
+				return nil, ErrInvalidSnapshot
+			}
+			return records, nil
+		}
+
+		checksum.Write([]byte(line))
+		record := types.ItemRecord{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			return nil, ErrInvalidSnapshot
+		}
+		records = append(records, record)
+	}
+}
+
+// Saves snapshot into the file. Temporary file is used, so the previous snapshot is kept if it fails.
+func (cache *Cache) SnapshotToFile(filename string) error {
+	tmp, err := os.Create(filepath.Join(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp"))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := cache.Snapshot(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+func (cache *Cache) RestoreFromFile(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return cache.Restore(file)
+}
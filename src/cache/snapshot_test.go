@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	types "tohan.net/go-practice/src/cache/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_SnapshotRestore(t *testing.T) {
+	cache := prepareBrandNewCache()
+	cache.FillWithDefaultData()
+	cache.AddItemWithTTL(types.CacheItem{Key: "forever", Value: "1"}, types.NoExpiration)
+	cache.AddItem(types.NewPayloadItem("binary", []byte{0, 1, 2}, types.ContentTypeBinary))
+	cache.GetItem("one")
+
+	buffer := bytes.Buffer{}
+	assert.Nil(t, cache.Snapshot(&buffer), "snapshot should be written")
+
+	restored := prepareBrandNewCache()
+	assert.Nil(t, restored.Restore(&buffer), "snapshot should be restored")
+	assert.Equal(t, cache.Size(), restored.Size(), "all items should be restored")
+	for key, wrappedItem := range cache.Store {
+		assert.Equal(t, wrappedItem, restored.Store[key], "items should be restored with metadata")
+	}
+
+	restored.AddItem(types.CacheItem{Key: "new", Value: "1"})
+	assert.True(t, restored.Store["new"].Version > cache.version, "versions should keep growing after restore")
+}
+
+func TestCache_RestoreSkipsExpired(t *testing.T) {
+	cache := prepareBrandNewCache()
+	cache.FillWithDefaultDataAsExpired()
+	cache.AddItem(types.CacheItem{Key: "fresh", Value: "1"})
+
+	buffer := bytes.Buffer{}
+	cache.Snapshot(&buffer)
+	restored := prepareBrandNewCache()
+	assert.Nil(t, restored.Restore(&buffer), "snapshot should be restored")
+	assert.Equal(t, int64(1), restored.Size(), "expired items shouldnt be restored")
+}
+
+func TestCache_RestoreExpiredRemovesOlderItem(t *testing.T) {
+	cache := prepareBrandNewCache()
+	cache.FillWithDefaultDataAsExpired()
+	buffer := bytes.Buffer{}
+	cache.Snapshot(&buffer)
+
+	restored := prepareBrandNewCache()
+	restored.FillWithDefaultData()
+	assert.Nil(t, restored.Restore(&buffer), "snapshot should be restored")
+	assert.Equal(t, int64(0), restored.Size(), "items overwritten by expired ones shouldnt stay")
+}
+
+func TestCache_RestoreCorrupted(t *testing.T) {
+	cache := prepareBrandNewCache()
+	cache.FillWithDefaultData()
+	buffer := bytes.Buffer{}
+	cache.Snapshot(&buffer)
+	snapshot := buffer.String()
+
+	restored := prepareBrandNewCache()
+	tampered := strings.Replace(snapshot, defaultTestKeyValues["one"], "hacked", 1)
+	assert.Equal(t, ErrInvalidSnapshot, restored.Restore(strings.NewReader(tampered)), "checksum should be verified")
+	truncated := snapshot[:len(snapshot)-20]
+	assert.Equal(t, ErrInvalidSnapshot, restored.Restore(strings.NewReader(truncated)), "truncated snapshot should be detected")
+	assert.NotNil(t, restored.Restore(strings.NewReader("GPCACHE 99\n")), "unknown version should be rejected")
+	assert.Empty(t, restored.Size(), "nothing should be restored from corrupted snapshot")
+}
+
+func TestCache_SnapshotToFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "snapshot")
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "cache.snapshot")
+
+	cache := prepareBrandNewCache()
+	cache.FillWithDefaultData()
+	assert.Nil(t, cache.SnapshotToFile(filename), "snapshot should be saved")
+
+	restored := prepareBrandNewCache()
+	assert.Nil(t, restored.RestoreFromFile(filename), "snapshot should be restored")
+	assert.Equal(t, cache.Size(), restored.Size(), "all items should be restored")
+}
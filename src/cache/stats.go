@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"time"
+
+	types "tohan.net/go-practice/src/cache/types"
+)
+
+func (cache *Cache) Stats() types.CacheStats {
+	// write lock because hits are counted under the read lock
+	cache.m.Lock()
+	defer cache.m.Unlock()
+
+	stats := cache.stats
+	stats.Items = cache.Size()
+	stats.UsedBytes = cache.usedBytes
+	stats.NegativeItems = int64(cache.negatives.Len())
+	return stats
+}
+
+// Caller must hold the write lock.
+func (cache *Cache) countRead(found bool, isNegative bool) {
+	if found {
+		cache.stats.Hits++
+		return
+	}
+	cache.stats.Misses++
+	if isNegative {
+		cache.stats.NegativeHits++
+	}
+}
+
+// Key was confirmed absent by loader recently. Caller must hold the write lock.
+func (cache *Cache) isNegative(key string) bool {
+	expirationAt, found := cache.negatives.Get(key)
+	if found && expirationAt <= time.Now().Unix() {
+		cache.negatives.Remove(key)
+		return false
+	}
+	return found
+}
+
+// Key was confirmed absent by loader recently
+func (cache *Cache) IsNegative(key string) bool {
+	cache.m.Lock()
+	defer cache.m.Unlock()
+
+	return cache.isNegative(key)
+}
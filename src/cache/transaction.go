@@ -0,0 +1,72 @@
+package cache
+
+import (
+	types "tohan.net/go-practice/src/cache/types"
+)
+
+// Multi-key transaction. Writes are buffered and applied all at once
+// when the transaction function returns without error.
+type Tx struct {
+	cache  *Cache
+	writes map[string]*types.CacheItem // nil item is a deletion
+	order  []string                    // keys in order of their first write
+}
+
+// Runs `fn` under the cache lock and applies its writes atomically.
+// When `fn` returns error (or panics) nothing is applied. Returns `ErrNotStored` and applies
+// nothing if some item would be rejected by admission policy or it's bigger than `MaxBytes`.
+// Don't call other methods of the cache inside of `fn`, it would deadlock.
+func (cache *Cache) Transaction(fn func(tx *Tx) error) error {
+	cache.m.Lock()
+	defer cache.m.Unlock()
+
+	tx := &Tx{cache: cache, writes: make(map[string]*types.CacheItem)}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	for _, item := range tx.writes {
+		if item != nil && !cache.fits(*item) {
+			return ErrNotStored
+		}
+	}
+
+	// items were admitted above, evictions made by the previous ones can't change it
+	cache.txAdmitted = true
+	defer func() { cache.txAdmitted = false }()
+	for _, key := range tx.order {
+		if item := tx.writes[key]; item != nil {
+			cache.set(*item)
+		} else {
+			cache.removeBecause(key, RemovalDeleted)
+			cache.persistDelete(key)
+		}
+	}
+	return nil
+}
+
+// Returns item as seen by the transaction - including its own writes.
+func (tx *Tx) Get(key string) (types.CacheItem, bool) {
+	if item, written := tx.writes[key]; written {
+		if item == nil {
+			return types.CacheItem{}, false
+		}
+		return *item, true
+	}
+	wrappedItem, found := tx.cache.lookup(key)
+	return wrappedItem.ToCacheItem(), found
+}
+
+func (tx *Tx) Set(item types.CacheItem) {
+	tx.write(item.Key, &item)
+}
+
+func (tx *Tx) Delete(key string) {
+	tx.write(key, nil)
+}
+
+func (tx *Tx) write(key string, item *types.CacheItem) {
+	if _, written := tx.writes[key]; !written {
+		tx.order = append(tx.order, key)
+	}
+	tx.writes[key] = item
+}
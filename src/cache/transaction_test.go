@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+
+	types "tohan.net/go-practice/src/cache/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_Transaction(t *testing.T) {
+	cache := prepareBrandNewCache()
+	cache.FillWithDefaultData()
+
+	err := cache.Transaction(func(tx *Tx) error {
+		tx.Set(types.CacheItem{Key: "new", Value: "1"})
+		tx.Delete("one")
+
+		_, found := tx.Get("one")
+		assert.False(t, found, "transaction should see its own deletion")
+		item, _ := tx.Get("new")
+		assert.Equal(t, "1", item.Value, "transaction should see its own write")
+		item, _ = tx.Get("two")
+		assert.Equal(t, defaultTestKeyValues["two"], item.Value, "transaction should see cache items")
+
+		_, found = cache.Store["new"]
+		assert.False(t, found, "writes shouldnt be applied before commit")
+		return nil
+	})
+	assert.Nil(t, err, "transaction should succeed")
+
+	_, found := cache.GetItem("new")
+	assert.True(t, found, "write should be applied")
+	_, found = cache.GetItem("one")
+	assert.False(t, found, "deletion should be applied")
+}
+
+func TestCache_TransactionRollback(t *testing.T) {
+	cache := prepareBrandNewCache()
+	cache.FillWithDefaultData()
+
+	err := cache.Transaction(func(tx *Tx) error {
+		tx.Set(types.CacheItem{Key: "new", Value: "1"})
+		tx.Delete("one")
+		return errors.New("failed")
+	})
+	assert.NotNil(t, err, "error should be returned")
+
+	_, found := cache.GetItem("new")
+	assert.False(t, found, "write shouldnt be applied")
+	_, found = cache.GetItem("one")
+	assert.True(t, found, "deletion shouldnt be applied")
+}
+
+func TestCache_TransactionNotStored(t *testing.T) {
+	config := NewMockCache().Config
+	config.Capacity = 1
+	config.AdmissionPolicy = types.AdmissionTinyLFU
+	cache := NewCache(config)
+	cache.AddItem(types.CacheItem{Key: "a", Value: "1"})
+	cache.GetItem("a")
+
+	err := cache.Transaction(func(tx *Tx) error {
+		tx.Delete("a")
+		tx.Set(types.CacheItem{Key: "x", Value: "1"})
+		return nil
+	})
+	assert.Equal(t, ErrNotStored, err, "item rejected by admission policy should be reported")
+	_, found := cache.Store["a"]
+	assert.True(t, found, "nothing should be applied when item is rejected")
+
+	cache.Config.MaxBytes = 50
+	err = cache.Transaction(func(tx *Tx) error {
+		tx.Set(types.CacheItem{Key: "a", Value: "2"})
+		tx.Set(types.CacheItem{Key: "big", Value: string(make([]byte, 100))})
+		return nil
+	})
+	assert.Equal(t, ErrNotStored, err, "item bigger than MaxBytes should be reported")
+	assert.Equal(t, "1", cache.Store["a"].Value, "nothing should be applied when item is too big")
+}
+
+func TestCache_TransactionEvictsForItsItems(t *testing.T) {
+	cache := prepareBrandNewCache()
+	cache.Config.Capacity = 2
+	cache.AddItem(types.CacheItem{Key: "a", Value: "1"})
+
+	err := cache.Transaction(func(tx *Tx) error {
+		tx.Set(types.CacheItem{Key: "b", Value: "2"})
+		tx.Set(types.CacheItem{Key: "c", Value: "3"})
+		return nil
+	})
+	assert.Nil(t, err, "transaction should succeed")
+	assert.Equal(t, int64(2), cache.Size(), "capacity should be kept")
+	_, found := cache.Store["c"]
+	assert.True(t, found, "all items of transaction should be stored")
+}
@@ -0,0 +1,19 @@
+package types
+
+// Types of cache events
+const (
+	EventSet    = "set"    // item was inserted or updated
+	EventDelete = "delete" // item was removed
+	EventExpire = "expire" // item expired
+	EventEvict  = "evict"  // item was evicted to make a space for another one
+)
+
+// Change of one item. `Old` is nil for new items, `New` is nil for removed ones.
+type CacheEvent struct {
+	ID   uint64     `json:"id"` // grows with every event
+	Type string     `json:"type"`
+	Key  string     `json:"key"`
+	Old  *CacheItem `json:"old,omitempty"`
+	New  *CacheItem `json:"new,omitempty"`
+	Time int64      `json:"time"`
+}
@@ -4,36 +4,118 @@ import (
 	"time"
 )
 
+// TTL of item that never expires
+const NoExpiration int32 = -1
+
 type CacheItem struct {
-	Key   string `json:"key"`
-	Value string `json:"value"`
+	Key         string `json:"key"`
+	Value       string `json:"value"`
+	Payload     []byte `json:"payload,omitempty"`     // Binary value. Used instead of `Value` if set
+	ContentType string `json:"contentType,omitempty"` // Type of the payload, e.g. `application/json`
+	TTL         int32  `json:"ttl,omitempty"`         // 0 for cache default, `NoExpiration` to keep item forever
+	Sliding     bool   `json:"sliding,omitempty"`     // Reading of item prolongs its expiration
 }
 
 // wrap cache item for internal usage of cache manager
 type CacheItemWrapper struct {
 	CacheItem
-	ExpirationAt int64
+	ExpirationAt int64  // 0 if item never expires
+	CreatedAt    int64  // first insert of the key
+	UpdatedAt    int64  // last write of the key
+	AccessedAt   int64  // last read of the key. 0 if never read
+	AccessCount  int64  // number of reads
+	Version      uint64 // changes with every write. Never repeats in one cache
+}
+
+// Metadata of the item for debugging and conditional writes
+type ItemMeta struct {
+	ExpirationAt int64  `json:"expirationAt"`
+	CreatedAt    int64  `json:"createdAt"`
+	UpdatedAt    int64  `json:"updatedAt"`
+	AccessedAt   int64  `json:"accessedAt"`
+	AccessCount  int64  `json:"accessCount"`
+	Version      uint64 `json:"version"`
+	Stale        bool   `json:"stale"` // expired item served during grace period
+}
+
+// TTL is positive, 0 (cache default) or `NoExpiration`
+func (item CacheItem) HasValidTTL() bool {
+	return item.TTL >= NoExpiration
 }
 
 func (item *CacheItemWrapper) IsExpired() bool {
-	return item.ExpirationAt <= time.Now().Unix()
+	return item.ExpirationAt != 0 && item.ExpirationAt <= time.Now().Unix()
 }
 
 func (item *CacheItemWrapper) ToCacheItem() CacheItem {
-	return CacheItem{
-		Key:   item.Key,
-		Value: item.Value,
+	return item.CacheItem
+}
+
+func (item *CacheItemWrapper) Meta() ItemMeta {
+	return ItemMeta{
+		ExpirationAt: item.ExpirationAt,
+		CreatedAt:    item.CreatedAt,
+		UpdatedAt:    item.UpdatedAt,
+		AccessedAt:   item.AccessedAt,
+		AccessCount:  item.AccessCount,
+		Version:      item.Version,
+		Stale:        item.IsExpired(),
+	}
+}
+
+// Item with its metadata in a form which can be saved and restored
+type ItemRecord struct {
+	Item CacheItem `json:"item"`
+	Meta ItemMeta  `json:"meta"`
+}
+
+func (item *CacheItemWrapper) ToRecord() ItemRecord {
+	return ItemRecord{Item: item.CacheItem, Meta: item.Meta()}
+}
+
+func (record *ItemRecord) ToWrapper() CacheItemWrapper {
+	return CacheItemWrapper{
+		CacheItem:    record.Item,
+		ExpirationAt: record.Meta.ExpirationAt,
+		CreatedAt:    record.Meta.CreatedAt,
+		UpdatedAt:    record.Meta.UpdatedAt,
+		AccessedAt:   record.Meta.AccessedAt,
+		AccessCount:  record.Meta.AccessCount,
+		Version:      record.Meta.Version,
 	}
 }
 
 type CacheConfig struct {
-	TTL                      int32 `json:"ttl"`                      // Expiration of items.
-	Capacity                 int64 `json:"capacity"`                 // Capacity of the cache.
-	ExpCheckFrequency        int32 `json:"expirationCheckFrequency"` // How often remove expired items. 0 to turn it off
-	GetAdaptersDataFrequency int32 `json:"getAdaptersDataFrequency"` // How often we want to get data from adapters
-	AdaptersBufferSize       int64 `json:"adaptersBufferSize"`       // If we want to limit the amount of data before colleciton
+	TTL                      int32  `json:"ttl"`                      // Default expiration of items.
+	Capacity                 int64  `json:"capacity"`                 // Capacity of the cache.
+	MaxBytes                 int64  `json:"maxBytes"`                 // Max size of keys and values in bytes. 0 for unlimited
+	ExpCheckFrequency        int32  `json:"expirationCheckFrequency"` // How often remove expired items. 0 to turn it off
+	ExpBatchSize             int64  `json:"expirationBatchSize"`      // How many expired items remove under one lock. 0 for default
+	GetAdaptersDataFrequency int32  `json:"getAdaptersDataFrequency"` // How often we want to get data from adapters
+	AdaptersBufferSize       int64  `json:"adaptersBufferSize"`       // If we want to limit the amount of data before colleciton
+	EvictionPolicy           string `json:"evictionPolicy"`           // Which item to remove on overflow. `lru` by default
+	SlidingExpiration        bool   `json:"slidingExpiration"`        // Reading of any item prolongs its expiration
+	Shards                   int32  `json:"shards"`                   // Number of shards of `ShardedCache`. 0 for default
+	StaleGracePeriod         int32  `json:"staleGracePeriod"`         // How long serve expired items while they are refreshed by loader
+	NegativeTTL              int32  `json:"negativeTTL"`              // How long remember keys unknown to loader. 0 to turn it off
+	WatchBufferSize          int32  `json:"watchBufferSize"`          // How many events are buffered for one watcher. 0 for default
+	EventHistorySize         int32  `json:"eventHistorySize"`         // How many last events are kept, so watchers can resume. 0 to turn it off
+	AdmissionPolicy          string `json:"admissionPolicy"`          // Which new items are saved when cache is full. All by default
 }
 
+// Supported eviction policies
+const (
+	EvictionLRU    = "lru"
+	EvictionLFU    = "lfu"
+	EvictionFIFO   = "fifo"
+	EvictionRandom = "random"
+)
+
+// Supported admission policies
+const (
+	AdmissionTinyLFU = "tinylfu"
+)
+
 // Use as a custom buffer
 type ItemsQueue struct {
 	items    []CacheItem // items queue
@@ -0,0 +1,17 @@
+package types
+
+// Counters of the cache
+type CacheStats struct {
+	Items         int64 `json:"items"`
+	UsedBytes     int64 `json:"usedBytes"`     // approximate size of all items
+	NegativeItems int64 `json:"negativeItems"` // keys confirmed absent by loader
+	Hits          int64 `json:"hits"`
+	Misses        int64 `json:"misses"`
+	NegativeHits  int64 `json:"negativeHits"` // misses answered by negative cache
+	Loads         int64 `json:"loads"`
+	LoadErrors    int64 `json:"loadErrors"`
+	DroppedEvents int64 `json:"droppedEvents"` // events which didn't fit into buffers of watchers
+	Admitted      int64 `json:"admitted"`      // new items which evicted another one
+	Rejected      int64 `json:"rejected"`      // new items rejected by admission policy
+	Oversized     int64 `json:"oversized"`     // items not stored because they are bigger than `MaxBytes`
+}
@@ -0,0 +1,106 @@
+package types
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+)
+
+// Common content types of payloads
+const (
+	ContentTypeText   = "text/plain"
+	ContentTypeJSON   = "application/json"
+	ContentTypeBinary = "application/octet-stream"
+)
+
+// Item with binary value tagged by its content type
+func NewPayloadItem(key string, payload []byte, contentType string) CacheItem {
+	return CacheItem{Key: key, Payload: payload, ContentType: contentType}
+}
+
+func (item CacheItem) HasPayload() bool {
+	return item.Payload != nil
+}
+
+// Payload is JSON document, e.g. `application/json` or `application/ld+json`
+func (item CacheItem) IsJSON() bool {
+	contentType := strings.ToLower(strings.TrimSpace(strings.Split(item.ContentType, ";")[0]))
+	return contentType == ContentTypeJSON || strings.HasSuffix(contentType, "+json")
+}
+
+// Payload can be printed as it is
+func (item CacheItem) IsText() bool {
+	return item.IsJSON() || strings.HasPrefix(strings.ToLower(item.ContentType), "text/")
+}
+
+// Raw value of the item
+func (item CacheItem) Bytes() []byte {
+	if item.HasPayload() {
+		return item.Payload
+	}
+	return []byte(item.Value)
+}
+
+// Printable value of the item. Binary payloads are base64 encoded.
+func (item CacheItem) ValueString() string {
+	if !item.HasPayload() {
+		return item.Value
+	}
+	if item.IsText() {
+		return string(item.Payload)
+	}
+	return base64.StdEncoding.EncodeToString(item.Payload)
+}
+
+// without methods, so it can be used inside of (Un)MarshalJSON
+type cacheItemJSON CacheItem
+
+// Marks JSON payload which is not valid JSON, so it had to be base64 encoded
+const payloadBase64 = "base64"
+
+// JSON payloads are embedded as they are, others are base64 encoded.
+func (item CacheItem) MarshalJSON() ([]byte, error) {
+	aux := struct {
+		cacheItemJSON
+		Payload         json.RawMessage `json:"payload,omitempty"`
+		PayloadEncoding string          `json:"payloadEncoding,omitempty"`
+	}{cacheItemJSON: cacheItemJSON(item)}
+
+	if item.HasPayload() {
+		if item.IsJSON() && json.Valid(item.Payload) {
+			aux.Payload = item.Payload
+		} else {
+			encoded, err := json.Marshal(item.Payload)
+			if err != nil {
+				return nil, err
+			}
+			aux.Payload = encoded
+			if item.IsJSON() {
+				aux.PayloadEncoding = payloadBase64
+			}
+		}
+	}
+	return json.Marshal(aux)
+}
+
+func (item *CacheItem) UnmarshalJSON(data []byte) error {
+	aux := struct {
+		*cacheItemJSON
+		Payload         json.RawMessage `json:"payload,omitempty"`
+		PayloadEncoding string          `json:"payloadEncoding,omitempty"`
+	}{cacheItemJSON: (*cacheItemJSON)(item)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	item.Payload = nil
+	if len(aux.Payload) == 0 || string(aux.Payload) == "null" {
+		return nil
+	}
+	if item.IsJSON() && aux.PayloadEncoding != payloadBase64 {
+		item.Payload = []byte(aux.Payload)
+		return nil
+	}
+	return json.Unmarshal(aux.Payload, &item.Payload)
+}
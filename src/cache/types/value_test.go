@@ -0,0 +1,59 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheItem_JSONPayload(t *testing.T) {
+	item := NewPayloadItem("1", []byte(`{"asset":"BTC"}`), ContentTypeJSON)
+
+	out, err := json.Marshal(item)
+	assert.Nil(t, err, "item should be serializable")
+	assert.Contains(t, string(out), `"payload":{"asset":"BTC"}`, "JSON payload should be embedded as it is")
+
+	decoded := CacheItem{}
+	assert.Nil(t, json.Unmarshal(out, &decoded), "item should be deserializable")
+	assert.Equal(t, item, decoded, "items should match")
+	assert.Equal(t, `{"asset":"BTC"}`, decoded.ValueString(), "JSON payload should be printable")
+}
+
+func TestCacheItem_InvalidJSONPayload(t *testing.T) {
+	item := NewPayloadItem("1", []byte(`{"asset":`), ContentTypeJSON)
+
+	out, err := json.Marshal(item)
+	assert.Nil(t, err, "item should be serializable")
+	assert.Contains(t, string(out), `"payloadEncoding":"base64"`, "invalid JSON payload should be marked as base64 encoded")
+
+	decoded := CacheItem{}
+	assert.Nil(t, json.Unmarshal(out, &decoded), "item should be deserializable")
+	assert.Equal(t, item, decoded, "invalid JSON payload should survive round trip")
+
+	stringItem := NewPayloadItem("2", []byte(`"text"`), ContentTypeJSON)
+	out, _ = json.Marshal(stringItem)
+	decoded = CacheItem{}
+	json.Unmarshal(out, &decoded)
+	assert.Equal(t, stringItem, decoded, "JSON string payload should be kept as it is")
+}
+
+func TestCacheItem_BinaryPayload(t *testing.T) {
+	item := NewPayloadItem("1", []byte{0, 1, 2}, ContentTypeBinary)
+
+	out, err := json.Marshal(item)
+	assert.Nil(t, err, "item should be serializable")
+	assert.Contains(t, string(out), `"payload":"AAEC"`, "binary payload should be base64 encoded")
+
+	decoded := CacheItem{}
+	assert.Nil(t, json.Unmarshal(out, &decoded), "item should be deserializable")
+	assert.Equal(t, item.Payload, decoded.Payload, "payloads should match")
+	assert.Equal(t, "AAEC", decoded.ValueString(), "binary payload should be base64 encoded")
+}
+
+func TestCacheItem_StringValue(t *testing.T) {
+	decoded := CacheItem{}
+	assert.Nil(t, json.Unmarshal([]byte(`{"key":"1","value":"v","ttl":5}`), &decoded), "item should be deserializable")
+	assert.Equal(t, CacheItem{Key: "1", Value: "v", TTL: 5}, decoded, "items should match")
+	assert.Equal(t, []byte("v"), decoded.Bytes(), "string value should be returned as bytes")
+}
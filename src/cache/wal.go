@@ -0,0 +1,313 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	types "tohan.net/go-practice/src/cache/types"
+)
+
+// When the log is synced to the disk
+const (
+	WALSyncAlways      = "always"   // after every write, slowest but nothing is lost
+	WALSyncEverySecond = "everysec" // at most one second of writes can be lost
+	WALSyncNever       = "never"    // left to the OS
+)
+
+const (
+	walOpSet       = "set"
+	walOpDelete    = "delete"
+	walOpDeleteAll = "flush"
+)
+
+var errTornRecord = errors.New("unexpected end of record")
+
+// One line of the log
+type walRecord struct {
+	Op     string            `json:"op"`
+	Key    string            `json:"key,omitempty"`
+	Record *types.ItemRecord `json:"record,omitempty"`
+}
+
+// Append-only log of writes, so writes since the last snapshot survive restart.
+type writeAheadLog struct {
+	filename   string
+	file       *os.File
+	syncPolicy string
+	dirty      bool     // written since the last sync
+	compacting bool     // writes are collected in `tail` too
+	tail       [][]byte // writes since the compaction started
+	closed     bool
+	stop       chan struct{}
+	compaction sync.Mutex // one compaction at a time
+	sync.Mutex
+}
+
+func (wal *writeAheadLog) append(rec walRecord) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	wal.Lock()
+	defer wal.Unlock()
+
+	line = append(line, '\n')
+	if _, err := wal.file.Write(line); err != nil {
+		return err
+	}
+	if wal.compacting {
+		wal.tail = append(wal.tail, line)
+	}
+	if wal.syncPolicy == WALSyncAlways {
+		return wal.file.Sync()
+	}
+	wal.dirty = true
+	return nil
+}
+
+func (wal *writeAheadLog) sync() error {
+	wal.Lock()
+	defer wal.Unlock()
+
+	if !wal.dirty {
+		return nil
+	}
+	wal.dirty = false
+	return wal.file.Sync()
+}
+
+// Syncs the log every second and compacts it with given frequency.
+func (wal *writeAheadLog) run(cache *Cache, compactFrequency int32) {
+	syncTicker := time.NewTicker(time.Second)
+	defer syncTicker.Stop()
+	var compact <-chan time.Time
+	if compactFrequency > 0 {
+		compactTicker := time.NewTicker(time.Duration(compactFrequency) * time.Second)
+		defer compactTicker.Stop()
+		compact = compactTicker.C
+	}
+
+	for {
+		select {
+		case <-wal.stop:
+			return
+		case <-syncTicker.C:
+			if wal.syncPolicy != WALSyncEverySecond {
+				continue
+			}
+			if err := wal.sync(); err != nil {
+				fmt.Println("Syncing of write-ahead log failed:", err)
+			}
+		case <-compact:
+			if err := cache.CompactWAL(); err != nil {
+				fmt.Println("Compaction of write-ahead log failed:", err)
+			}
+		}
+	}
+}
+
+// Caller must hold the write lock, so the log gets writes in the same order as the cache.
+func (cache *Cache) appendWAL(rec walRecord) {
+	if cache.wal == nil {
+		return
+	}
+	if err := cache.wal.append(rec); err != nil {
+		fmt.Println("Writing to write-ahead log failed:", rec.Op, rec.Key, err)
+	}
+}
+
+// Replays the log on top of the current items (e.g. restored snapshot) and logs all next writes into it.
+// Log is compacted every `compactFrequency` seconds, 0 disables it.
+func (cache *Cache) OpenWAL(filename string, syncPolicy string, compactFrequency int32) error {
+	switch syncPolicy {
+	case WALSyncAlways, WALSyncEverySecond, WALSyncNever:
+	default:
+		return fmt.Errorf("cache: unknown WAL sync policy %q", syncPolicy)
+	}
+
+	cache.m.Lock()
+	defer cache.m.Unlock()
+
+	if cache.wal != nil {
+		return fmt.Errorf("cache: WAL is already open")
+	}
+	if err := cache.replayWAL(filename); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	cache.wal = &writeAheadLog{
+		filename:   filename,
+		file:       file,
+		syncPolicy: syncPolicy,
+		stop:       make(chan struct{}),
+	}
+	go cache.wal.run(cache, compactFrequency)
+	return nil
+}
+
+// Caller must hold the write lock.
+func (cache *Cache) replayWAL(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReaderSize(file, 64*1024)
+	var end int64 // end of the last complete record
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) == 0 {
+				return nil
+			}
+			// record without new line was written just partially
+			err = errTornRecord
+		}
+		rec := walRecord{}
+		if err == nil {
+			err = json.Unmarshal(line, &rec)
+		}
+		if err != nil {
+			// last line may be written just partially before crash, it's cut off
+			// so next records are not appended to it
+			fmt.Println("Replaying of write-ahead log stopped at invalid record:", err)
+			return os.Truncate(filename, end)
+		}
+		end += int64(len(line))
+
+		switch rec.Op {
+		case walOpSet:
+			if rec.Record != nil {
+				cache.putRecord(*rec.Record)
+			}
+		case walOpDelete:
+			cache.remove(rec.Key)
+		case walOpDeleteAll:
+			for key := range cache.Store {
+				cache.remove(key)
+			}
+		}
+	}
+}
+
+// Rewrites the log so it contains just the current items. Items are copied under the read lock,
+// the rest runs without it. Writes meanwhile go to the old log and are appended to the new one at the end.
+func (cache *Cache) CompactWAL() error {
+	cache.m.RLock()
+	wal := cache.wal
+	cache.m.RUnlock()
+	if wal == nil {
+		return nil
+	}
+	wal.compaction.Lock()
+	defer wal.compaction.Unlock()
+
+	cache.m.RLock()
+	if cache.wal != wal {
+		// closed meanwhile
+		cache.m.RUnlock()
+		return nil
+	}
+	records := make([]types.ItemRecord, 0, len(cache.Store))
+	for _, wrappedItem := range cache.Store {
+		records = append(records, wrappedItem.ToRecord())
+	}
+	wal.Lock()
+	wal.compacting = true
+	wal.Unlock()
+	cache.m.RUnlock()
+
+	defer func() {
+		wal.Lock()
+		wal.compacting = false
+		wal.tail = nil
+		wal.Unlock()
+	}()
+
+	tmp, err := os.Create(filepath.Join(filepath.Dir(wal.filename), "."+filepath.Base(wal.filename)+".tmp"))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	bw := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(bw)
+	// items missing in the log have to be removed from the snapshot too
+	err = encoder.Encode(walRecord{Op: walOpDeleteAll})
+	for i := 0; i < len(records) && err == nil; i++ {
+		err = encoder.Encode(walRecord{Op: walOpSet, Record: &records[i]})
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err != nil {
+		return err
+	}
+
+	// just writes since the copy are done under the log lock
+	wal.Lock()
+	defer wal.Unlock()
+
+	if wal.closed {
+		return nil
+	}
+	for _, line := range wal.tail {
+		if _, err := tmp.Write(line); err != nil {
+			return err
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), wal.filename); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(wal.filename, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	wal.file.Close()
+	wal.file = file
+	wal.dirty = false
+	return nil
+}
+
+// Syncs and closes the log. Next writes are not logged.
+func (cache *Cache) CloseWAL() error {
+	cache.m.Lock()
+	defer cache.m.Unlock()
+
+	wal := cache.wal
+	if wal == nil {
+		return nil
+	}
+	cache.wal = nil
+	close(wal.stop)
+
+	wal.Lock()
+	defer wal.Unlock()
+
+	wal.closed = true
+	if err := wal.file.Sync(); err != nil {
+		wal.file.Close()
+		return err
+	}
+	return wal.file.Close()
+}
@@ -0,0 +1,224 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	types "tohan.net/go-practice/src/cache/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_WALReplay(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wal")
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "cache.wal")
+
+	cache := prepareBrandNewCache()
+	assert.Nil(t, cache.OpenWAL(filename, WALSyncAlways, 0), "log should be opened")
+	cache.FillWithDefaultData()
+	cache.RemoveItem("one")
+	cache.AddItem(types.CacheItem{Key: "two", Value: "updated"})
+	assert.Nil(t, cache.CloseWAL(), "log should be closed")
+
+	restored := prepareBrandNewCache()
+	assert.Nil(t, restored.OpenWAL(filename, WALSyncNever, 0), "log should be replayed")
+	defer restored.CloseWAL()
+	assert.Equal(t, cache.Size(), restored.Size(), "all writes should be replayed")
+	for key, wrappedItem := range cache.Store {
+		assert.Equal(t, wrappedItem, restored.Store[key], "items should be replayed with metadata")
+	}
+
+	restored.RemoveAllItems()
+	restored.AddItem(types.CacheItem{Key: "after", Value: "flush"})
+	assert.Nil(t, restored.CloseWAL(), "log should be closed")
+	again := prepareBrandNewCache()
+	assert.Nil(t, again.OpenWAL(filename, WALSyncNever, 0), "log should be replayed")
+	defer again.CloseWAL()
+	assert.Equal(t, int64(1), again.Size(), "items removed by flush shouldnt be replayed")
+}
+
+func TestCache_WALOnTopOfSnapshot(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wal")
+	defer os.RemoveAll(dir)
+	snapshot := filepath.Join(dir, "cache.snapshot")
+	filename := filepath.Join(dir, "cache.wal")
+
+	cache := prepareBrandNewCache()
+	cache.OpenWAL(filename, WALSyncEverySecond, 0)
+	cache.FillWithDefaultData()
+	cache.SnapshotToFile(snapshot)
+	cache.RemoveItem("one")
+	cache.AddItem(types.CacheItem{Key: "new", Value: "1"})
+	cache.CloseWAL()
+
+	restored := prepareBrandNewCache()
+	assert.Nil(t, restored.RestoreFromFile(snapshot), "snapshot should be restored")
+	assert.Nil(t, restored.OpenWAL(filename, WALSyncEverySecond, 0), "log should be replayed")
+	defer restored.CloseWAL()
+	_, found := restored.GetItem("one")
+	assert.False(t, found, "item removed after snapshot shouldnt be restored")
+	_, found = restored.GetItem("new")
+	assert.True(t, found, "item added after snapshot should be restored")
+	version, _ := restored.Upsert(types.CacheItem{Key: "next"})
+	assert.True(t, version > cache.version, "versions should keep growing after replay")
+}
+
+func TestCache_WALExpiredRecordRemovesSnapshotItem(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wal")
+	defer os.RemoveAll(dir)
+	snapshot := filepath.Join(dir, "cache.snapshot")
+	filename := filepath.Join(dir, "cache.wal")
+
+	cache := prepareBrandNewCache()
+	cache.AddItemWithTTL(types.CacheItem{Key: "k", Value: "old"}, 1000)
+	cache.SnapshotToFile(snapshot)
+	cache.OpenWAL(filename, WALSyncAlways, 0)
+	cache.AddItemWithTTL(types.CacheItem{Key: "k", Value: "new"}, 1)
+	// as if the new value expired meanwhile
+	wrappedItem := cache.Store["k"]
+	wrappedItem.ExpirationAt -= 10
+	cache.logSet(wrappedItem)
+	cache.CloseWAL()
+
+	restored := prepareBrandNewCache()
+	restored.RestoreFromFile(snapshot)
+	assert.Nil(t, restored.OpenWAL(filename, WALSyncAlways, 0), "log should be replayed")
+	defer restored.CloseWAL()
+	_, found := restored.GetItem("k")
+	assert.False(t, found, "overwritten value shouldnt come back when the new one expired")
+}
+
+func TestCache_WALTruncatedRecord(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wal")
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "cache.wal")
+
+	cache := prepareBrandNewCache()
+	cache.OpenWAL(filename, WALSyncAlways, 0)
+	cache.FillWithDefaultData()
+	cache.CloseWAL()
+	file, _ := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND, 0644)
+	file.WriteString(`{"op":"set","record":{"item":{"key":"half`)
+	file.Close()
+
+	restored := prepareBrandNewCache()
+	assert.Nil(t, restored.OpenWAL(filename, WALSyncAlways, 0), "partially written record should be ignored")
+	defer restored.CloseWAL()
+	assert.Equal(t, cache.Size(), restored.Size(), "complete records should be replayed")
+	assert.NotNil(t, prepareBrandNewCache().OpenWAL(filename, "sometimes", 0), "unknown sync policy should be rejected")
+}
+
+func TestCache_WALWriteAfterTruncatedRecord(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wal")
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "cache.wal")
+
+	cache := prepareBrandNewCache()
+	cache.OpenWAL(filename, WALSyncAlways, 0)
+	cache.AddItem(types.CacheItem{Key: "a", Value: "1"})
+	cache.CloseWAL()
+	file, _ := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND, 0644)
+	file.WriteString(`{"op":"set","record":{"item":{"key":"half`)
+	file.Close()
+
+	restarted := prepareBrandNewCache()
+	assert.Nil(t, restarted.OpenWAL(filename, WALSyncAlways, 0), "partially written record should be ignored")
+	restarted.AddItem(types.CacheItem{Key: "b", Value: "2"})
+	restarted.CloseWAL()
+
+	again := prepareBrandNewCache()
+	assert.Nil(t, again.OpenWAL(filename, WALSyncAlways, 0), "log should be replayed")
+	defer again.CloseWAL()
+	_, found := again.Store["a"]
+	assert.True(t, found, "write before crash should be replayed")
+	_, found = again.Store["b"]
+	assert.True(t, found, "write after partially written record should survive next restart")
+}
+
+func TestCache_CompactWAL(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wal")
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "cache.wal")
+
+	cache := prepareBrandNewCache()
+	cache.OpenWAL(filename, WALSyncAlways, 0)
+	for i := 0; i < 100; i++ {
+		cache.AddItem(types.CacheItem{Key: "counter", Value: string(rune('a' + i%26))})
+	}
+	cache.FillWithDefaultData()
+	cache.RemoveItem("one")
+	before, _ := os.Stat(filename)
+
+	assert.Nil(t, cache.CompactWAL(), "log should be compacted")
+	after, _ := os.Stat(filename)
+	assert.True(t, after.Size() < before.Size(), "compacted log should be smaller")
+
+	cache.AddItem(types.CacheItem{Key: "after", Value: "compaction"})
+	cache.CloseWAL()
+	restored := prepareBrandNewCache()
+	restored.AddItem(types.CacheItem{Key: "one", Value: "from snapshot"})
+	assert.Nil(t, restored.OpenWAL(filename, WALSyncAlways, 0), "compacted log should be replayed")
+	defer restored.CloseWAL()
+	assert.Equal(t, cache.Size(), restored.Size(), "compacted log should contain all items")
+	_, found := restored.Store["one"]
+	assert.False(t, found, "compacted log should replace older items")
+}
+
+func TestCache_CompactWALWithConcurrentWrites(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wal")
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "cache.wal")
+
+	cache := prepareBrandNewCache()
+	cache.OpenWAL(filename, WALSyncNever, 0)
+	cache.FillWithDefaultData()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 500; i++ {
+			cache.AddItem(types.CacheItem{Key: strconv.Itoa(i % 50), Value: strconv.Itoa(i)})
+		}
+	}()
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, cache.CompactWAL(), "log should be compacted")
+	}
+	<-done
+	cache.CloseWAL()
+
+	restored := prepareBrandNewCache()
+	assert.Nil(t, restored.OpenWAL(filename, WALSyncNever, 0), "compacted log should be replayed")
+	defer restored.CloseWAL()
+	assert.Equal(t, cache.Store, restored.Store, "writes during compaction shouldnt be lost")
+}
+
+func TestCache_WALLogsTouch(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wal")
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "cache.wal")
+
+	cache := prepareBrandNewCache()
+	cache.OpenWAL(filename, WALSyncNever, 0)
+	cache.AddItem(types.CacheItem{Key: "touched", Value: "1"})
+	cache.AddItem(types.CacheItem{Key: "sliding", Value: "1", Sliding: true})
+	for _, key := range []string{"touched", "sliding"} {
+		wrappedItem := cache.Store[key]
+		wrappedItem.ExpirationAt -= 20 // as if it was written a while ago
+		cache.setWrapped(wrappedItem)
+	}
+	assert.True(t, cache.Touch("touched"), "item should be touched")
+	cache.GetItem("sliding")
+	cache.CloseWAL()
+	assert.InDelta(t, time.Now().Unix()+30, cache.Store["touched"].ExpirationAt, 1, "expiration should be prolonged")
+
+	restored := prepareBrandNewCache()
+	assert.Nil(t, restored.OpenWAL(filename, WALSyncNever, 0), "log should be replayed")
+	defer restored.CloseWAL()
+	assert.Equal(t, cache.Store["touched"].ExpirationAt, restored.Store["touched"].ExpirationAt, "touch should be replayed")
+	assert.Equal(t, cache.Store["sliding"].ExpirationAt, restored.Store["sliding"].ExpirationAt, "sliding expiration should be replayed")
+}
@@ -0,0 +1,153 @@
+package cache
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+
+	types "tohan.net/go-practice/src/cache/types"
+)
+
+// How many events are buffered for one watcher by default
+const DefaultWatchBufferSize = 100
+
+// Subscription to changes of items with the key prefix.
+type Watcher struct {
+	Events  <-chan types.CacheEvent // closed by `Close`
+	events  chan types.CacheEvent
+	prefix  string
+	dropped uint64
+	cache   *Cache
+}
+
+// Returns watcher of items with the key prefix, empty prefix for all items.
+// Events are buffered, if the watcher doesn't keep up the new ones are dropped and counted.
+func (cache *Cache) Watch(prefix string) *Watcher {
+	cache.m.Lock()
+	defer cache.m.Unlock()
+
+	return cache.watch(prefix, nil)
+}
+
+// Same as `Watch` but the watcher gets also events after `lastEventID` kept in the history (see `EventHistorySize`).
+// Returns false if some of them are not in the history anymore.
+func (cache *Cache) WatchFrom(prefix string, lastEventID uint64) (*Watcher, bool) {
+	cache.m.Lock()
+	defer cache.m.Unlock()
+
+	missed, complete := cache.history.since(lastEventID, cache.eventID)
+	events := []types.CacheEvent{}
+	for _, event := range missed {
+		if strings.HasPrefix(event.Key, prefix) {
+			events = append(events, event)
+		}
+	}
+	return cache.watch(prefix, events), complete
+}
+
+// Caller must hold the write lock.
+func (cache *Cache) watch(prefix string, missed []types.CacheEvent) *Watcher {
+	bufferSize := int(cache.Config.WatchBufferSize)
+	if bufferSize <= 0 {
+		bufferSize = DefaultWatchBufferSize
+	}
+	events := make(chan types.CacheEvent, bufferSize+len(missed))
+	for _, event := range missed {
+		events <- event
+	}
+	watcher := &Watcher{Events: events, events: events, prefix: prefix, cache: cache}
+
+	if cache.watchers == nil {
+		cache.watchers = make(map[*Watcher]struct{})
+	}
+	cache.watchers[watcher] = struct{}{}
+	return watcher
+}
+
+// Number of events which didn't fit into the buffer
+func (watcher *Watcher) Dropped() uint64 {
+	return atomic.LoadUint64(&watcher.dropped)
+}
+
+// Stops the watcher and closes its channel. Already buffered events can be still read.
+func (watcher *Watcher) Close() {
+	cache := watcher.cache
+	cache.m.Lock()
+	defer cache.m.Unlock()
+
+	if _, found := cache.watchers[watcher]; found {
+		delete(cache.watchers, watcher)
+		close(watcher.events)
+	}
+}
+
+// Sends event to all watchers of the key. Caller must hold the write lock.
+func (cache *Cache) notify(eventType string, key string, old *types.CacheItem, new *types.CacheItem) {
+	if len(cache.watchers) == 0 && cache.Config.EventHistorySize <= 0 {
+		return
+	}
+	cache.eventID++
+	event := types.CacheEvent{ID: cache.eventID, Type: eventType, Key: key, Old: old, New: new, Time: time.Now().Unix()}
+	cache.history.add(event, int(cache.Config.EventHistorySize))
+
+	for watcher := range cache.watchers {
+		if !strings.HasPrefix(key, watcher.prefix) {
+			continue
+		}
+		// never block writers because of slow watcher
+		select {
+		case watcher.events <- event:
+		default:
+			atomic.AddUint64(&watcher.dropped, 1)
+			cache.stats.DroppedEvents++
+		}
+	}
+}
+
+// Caller must hold the write lock.
+func (cache *Cache) notifySet(previous *types.CacheItemWrapper, wrappedItem types.CacheItemWrapper) {
+	var old *types.CacheItem
+	if previous != nil {
+		old = &previous.CacheItem
+	}
+	cache.notify(types.EventSet, wrappedItem.Key, old, &wrappedItem.CacheItem)
+}
+
+// Ring buffer of the last events. Not safe for concurrent use.
+type eventHistory struct {
+	events []types.CacheEvent
+	next   int // where the next event is written
+}
+
+func (history *eventHistory) add(event types.CacheEvent, size int) {
+	if size <= 0 {
+		return
+	}
+	if len(history.events) < size {
+		history.events = append(history.events, event)
+		return
+	}
+	history.events[history.next] = event
+	history.next = (history.next + 1) % len(history.events)
+}
+
+// Events after `lastEventID` in order. False if some of them are not kept anymore.
+func (history *eventHistory) since(lastEventID uint64, currentEventID uint64) ([]types.CacheEvent, bool) {
+	if lastEventID == currentEventID {
+		return nil, true
+	}
+	if lastEventID > currentEventID {
+		// IDs started again, e.g. after restart
+		return nil, false
+	}
+	events := []types.CacheEvent{}
+	ordered := append(append([]types.CacheEvent{}, history.events[history.next:]...), history.events[:history.next]...)
+	for _, event := range ordered {
+		if event.ID > lastEventID {
+			events = append(events, event)
+		}
+	}
+	// IDs are consecutive, so the first one tells if anything is missing
+	complete := len(events) > 0 && events[0].ID == lastEventID+1
+	return events, complete
+}
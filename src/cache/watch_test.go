@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"testing"
+
+	types "tohan.net/go-practice/src/cache/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Returns events which are already in the buffer
+func drainEvents(watcher *Watcher) []types.CacheEvent {
+	events := []types.CacheEvent{}
+	for {
+		select {
+		case event, open := <-watcher.Events:
+			if !open {
+				return events
+			}
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func TestCache_Watch(t *testing.T) {
+	cache := prepareBrandNewCache()
+	watcher := cache.Watch("user:")
+	defer watcher.Close()
+
+	cache.AddItem(types.CacheItem{Key: "user:1", Value: "a"})
+	cache.AddItem(types.CacheItem{Key: "user:1", Value: "b"})
+	cache.AddItem(types.CacheItem{Key: "order:1", Value: "c"})
+	cache.RemoveItem("user:1")
+	cache.RemoveItem("user:2")
+
+	events := drainEvents(watcher)
+	assert.Equal(t, 3, len(events), "only changes of watched keys should be sent")
+	assert.Equal(t, types.EventSet, events[0].Type, "insert should be sent")
+	assert.Nil(t, events[0].Old, "insert shouldnt have old value")
+	assert.Equal(t, "a", events[1].Old.Value, "update should have old value")
+	assert.Equal(t, "b", events[1].New.Value, "update should have new value")
+	assert.Equal(t, types.EventDelete, events[2].Type, "removal should be sent")
+	assert.Equal(t, "b", events[2].Old.Value, "removal should have old value")
+	assert.Nil(t, events[2].New, "removal shouldnt have new value")
+	assert.True(t, events[0].ID < events[1].ID && events[1].ID < events[2].ID, "IDs of events should grow")
+}
+
+func TestCache_WatchExpireAndEvict(t *testing.T) {
+	cache := prepareBrandNewCache()
+	cache.Config.Capacity = 2
+	watcher := cache.Watch("")
+	defer watcher.Close()
+
+	cache.FillWithDefaultDataAsExpired()
+	drainEvents(watcher)
+	cache.RemoveExpiredItems()
+	for _, event := range drainEvents(watcher) {
+		assert.Equal(t, types.EventExpire, event.Type, "expired items should be sent")
+	}
+
+	cache.AddItem(types.CacheItem{Key: "1", Value: "1"})
+	cache.AddItem(types.CacheItem{Key: "2", Value: "2"})
+	cache.AddItem(types.CacheItem{Key: "3", Value: "3"})
+	events := drainEvents(watcher)
+	assert.Equal(t, types.EventEvict, events[2].Type, "eviction should be sent before insert")
+	assert.Equal(t, "1", events[2].Key, "evicted item should be sent")
+	assert.Equal(t, types.EventSet, events[3].Type, "insert should be sent after eviction")
+}
+
+func TestCache_WatchSlowWatcher(t *testing.T) {
+	cache := prepareBrandNewCache()
+	cache.Config.WatchBufferSize = 2
+	watcher := cache.Watch("")
+
+	for _, key := range []string{"1", "2", "3", "4", "5"} {
+		cache.AddItem(types.CacheItem{Key: key, Value: key})
+	}
+	assert.Equal(t, uint64(3), watcher.Dropped(), "events over the buffer should be dropped")
+	assert.Equal(t, int64(3), cache.Stats().DroppedEvents, "dropped events should be counted in stats")
+
+	watcher.Close()
+	assert.Equal(t, 2, len(drainEvents(watcher)), "buffered events should be readable after close")
+	_, open := <-watcher.Events
+	assert.False(t, open, "channel should be closed")
+	cache.AddItem(types.CacheItem{Key: "6", Value: "6"})
+	watcher.Close()
+}
+
+func TestCache_WatchFrom(t *testing.T) {
+	cache := prepareBrandNewCache()
+	cache.Config.EventHistorySize = 3
+
+	for _, key := range []string{"a:1", "b:1", "a:2", "a:3"} {
+		cache.AddItem(types.CacheItem{Key: key, Value: key})
+	}
+
+	watcher, complete := cache.WatchFrom("a:", 2)
+	defer watcher.Close()
+	assert.True(t, complete, "events after ID should be in history")
+	cache.AddItem(types.CacheItem{Key: "a:4", Value: "a:4"})
+	events := drainEvents(watcher)
+	assert.Equal(t, 3, len(events), "missed and new events of the prefix should be sent")
+	assert.Equal(t, []string{"a:2", "a:3", "a:4"}, []string{events[0].Key, events[1].Key, events[2].Key}, "events should be in order")
+
+	current, complete := cache.WatchFrom("", 5)
+	defer current.Close()
+	assert.True(t, complete, "nothing should be missed after the last event")
+	assert.Empty(t, drainEvents(current), "nothing should be replayed after the last event")
+
+	old, complete := cache.WatchFrom("", 0)
+	defer old.Close()
+	assert.False(t, complete, "events not kept in history should be reported")
+	assert.Equal(t, 3, len(drainEvents(old)), "kept events should be replayed anyway")
+
+	_, complete = cache.WatchFrom("", 100)
+	assert.False(t, complete, "unknown ID should be reported")
+}
@@ -14,7 +14,8 @@ import (
 	cacheTypes "tohan.net/go-practice/src/cache/types"
 )
 
-func ConsumeSentiments(c *cache.Cache, certFile string, server string) {
+// Sentiments are saved with the given TTL. 0 for cache default.
+func ConsumeSentiments(c *cache.Cache, certFile string, server string, ttl int32) {
 
 	creds, err := credentials.NewClientTLSFromFile(certFile, "")
 	if err != nil {
@@ -41,11 +42,19 @@ func ConsumeSentiments(c *cache.Cache, certFile string, server string) {
 		if err != nil {
 			panic(err)
 		}
-		out, err := json.Marshal(msg.Id)
+		key, err := json.Marshal(msg.Id)
 		if err != nil {
 			fmt.Println("Sentiment is in wrong format. Cannot process.")
 			continue
 		}
-		c.AddItem(cacheTypes.CacheItem{Key: string(out), Value: msg.Asset})
+		// keep the whole candle
+		out, err := json.Marshal(msg)
+		if err != nil {
+			fmt.Println("Sentiment is in wrong format. Cannot process.")
+			continue
+		}
+		if err := c.AddItemWithTTL(cacheTypes.NewPayloadItem(string(key), out, cacheTypes.ContentTypeJSON), ttl); err != nil {
+			fmt.Println("Sentiment cannot be cached:", err)
+		}
 	}
 }